@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/geckoboard/cake-bot/ctx"
+	"github.com/geckoboard/cake-bot/github"
+)
+
+// AssignMode decides what happens to pull requests that are opened without any
+// reviewers.
+type AssignMode string
+
+const (
+	// AssignOff leaves pull requests without reviewers alone.
+	AssignOff AssignMode = "off"
+	// AssignSuggest posts who would be assigned to the pull request's
+	// threads, without asking them on GitHub.
+	AssignSuggest AssignMode = "suggest"
+	// AssignRequest asks the reviewers to review the pull request on GitHub.
+	AssignRequest AssignMode = "request"
+)
+
+// ParseAssignMode returns the AssignMode named by s.
+func ParseAssignMode(s string) (AssignMode, error) {
+	switch m := AssignMode(s); m {
+	case AssignOff, AssignSuggest, AssignRequest:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown assign mode %q, expected off, suggest or request", s)
+}
+
+// AssignStrategy decides which of a pool's reviewers are assigned.
+type AssignStrategy string
+
+const (
+	// AssignRoundRobin assigns whoever was assigned least recently.
+	AssignRoundRobin AssignStrategy = "round_robin"
+	// AssignLeastLoaded assigns whoever has the fewest pending reviews, and
+	// then whoever was assigned least recently.
+	AssignLeastLoaded AssignStrategy = "least_loaded"
+)
+
+// AssignerAPI asks people to review pull requests on GitHub. *github.Client
+// implements it.
+type AssignerAPI interface {
+	PullRequestFiles(c context.Context, repo string, number int) ([]string, error)
+	RequestReviewers(c context.Context, repo string, number int, logins []string) error
+}
+
+// AssignNotifier lets people on Slack know who could review a pull request.
+type AssignNotifier interface {
+	// IsAvailable reports whether the user can be asked for a review now.
+	IsAvailable(*github.User) bool
+	// SuggestReviewers posts the reviewers that would have been assigned
+	// to the pull request.
+	SuggestReviewers(context.Context, *github.Repository, *github.PullRequest, []*github.User) error
+}
+
+// Assigner picks reviewers from the repository's pool for pull requests that
+// don't have any.
+type Assigner struct {
+	api      AssignerAPI
+	pools    *ReviewerPools
+	pending  ReminderStore
+	notifier AssignNotifier
+	mode     AssignMode
+
+	mu sync.Mutex
+	// assigned is when each reviewer, by lower case login, was last
+	// assigned, counted in assignments since startup.
+	assigned map[string]int
+	count    int
+}
+
+// NewAssigner instantiates an Assigner that balances reviews using the
+// pending reviews, and either suggests or requests reviewers depending on
+// mode.
+func NewAssigner(api AssignerAPI, pools *ReviewerPools, pending ReminderStore, notifier AssignNotifier, mode AssignMode) *Assigner {
+	return &Assigner{
+		api:      api,
+		pools:    pools,
+		pending:  pending,
+		notifier: notifier,
+		mode:     mode,
+		assigned: map[string]int{},
+	}
+}
+
+// Assign picks reviewers for the pull request, and either suggests them or
+// asks them on GitHub. GitHub's webhooks then notify them as usual.
+func (a *Assigner) Assign(c context.Context, repo *github.Repository, pr *github.PullRequest) error {
+	l := ctx.Logger(c)
+
+	pool := a.pools.Find(repo.FullName)
+	if pool == nil {
+		l.Info("at", "no_reviewer_pool")
+		return nil
+	}
+
+	candidates := pool.Reviewers
+	if len(pool.Owners) > 0 {
+		files, err := a.api.PullRequestFiles(c, repo.FullName, pr.Number)
+		if err != nil {
+			return err
+		}
+		if owners := pool.OwnersOf(files); len(owners) > 0 {
+			candidates = owners
+		}
+	}
+
+	logins, err := a.pick(pool, pr, candidates)
+	if err != nil {
+		return err
+	}
+	if len(logins) == 0 {
+		l.Info("at", "no_reviewers_to_assign")
+		return nil
+	}
+
+	if a.mode == AssignSuggest {
+		reviewers := make([]*github.User, len(logins))
+		for i, login := range logins {
+			reviewers[i] = &github.User{Login: login}
+		}
+		return a.notifier.SuggestReviewers(c, repo, pr, reviewers)
+	}
+
+	l.Info("at", "assign_reviewers", "reviewers", strings.Join(logins, ","))
+	return a.api.RequestReviewers(c, repo.FullName, pr.Number, logins)
+}
+
+// pick orders the candidates by the pool's strategy and returns as many as the
+// pool assigns to each pull request. Candidates that are away are only picked
+// if everyone is.
+func (a *Assigner) pick(pool *ReviewerPool, pr *github.PullRequest, candidates []string) ([]string, error) {
+	var load map[string]int
+	if pool.Strategy == AssignLeastLoaded {
+		reviews, err := a.pending.List()
+		if err != nil {
+			return nil, err
+		}
+		load = map[string]int{}
+		for _, review := range reviews {
+			load[strings.ToLower(review.Reviewer.Login)]++
+		}
+	}
+
+	var available, away []string
+	seen := map[string]bool{}
+	for _, login := range candidates {
+		switch {
+		case pr.User != nil && strings.EqualFold(login, pr.User.Login):
+		case seen[strings.ToLower(login)]:
+		case a.notifier.IsAvailable(&github.User{Login: login}):
+			available = append(available, login)
+		default:
+			away = append(away, login)
+		}
+		seen[strings.ToLower(login)] = true
+	}
+	if len(available) == 0 {
+		available = away
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	sort.SliceStable(available, func(i, j int) bool {
+		li, lj := strings.ToLower(available[i]), strings.ToLower(available[j])
+		if load[li] != load[lj] {
+			return load[li] < load[lj]
+		}
+		return a.assigned[li] < a.assigned[lj]
+	})
+
+	n := pool.ReviewersPerPullRequest
+	if n == 0 {
+		n = 1
+	}
+	if n > len(available) {
+		n = len(available)
+	}
+
+	for _, login := range available[:n] {
+		a.count++
+		a.assigned[strings.ToLower(login)] = a.count
+	}
+	return available[:n], nil
+}
+
+// needsReviewers reports whether nobody has been asked to review the pull
+// request yet.
+func needsReviewers(pr *github.PullRequest) bool {
+	return !pr.Draft && len(pr.RequestedReviewers) == 0 && len(pr.RequestedTeams) == 0
+}
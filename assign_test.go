@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/geckoboard/cake-bot/github"
+	"github.com/geckoboard/cake-bot/store"
+)
+
+func TestAssignerRoundRobin(t *testing.T) {
+	pools := &ReviewerPools{Pools: []ReviewerPool{
+		{Repositories: []string{"geckoboard/*"}, Reviewers: []string{"author", "alice", "away", "bob"}},
+	}}
+	api := &fakeReviewerAPI{}
+	notifier := &fakeReassignNotifier{away: []string{"away"}}
+	a := NewAssigner(api, pools, NewStoreReminderStore(store.NewMemory()), notifier, AssignRequest)
+
+	for i := 0; i < 3; i++ {
+		if err := a.Assign(context.Background(), testRepo, testPR); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if want := []string{"alice", "bob", "alice"}; !reflect.DeepEqual(api.requested, want) {
+		t.Errorf("expected %v to be asked in turn, got: %v", want, api.requested)
+	}
+}
+
+func TestAssignerLeastLoaded(t *testing.T) {
+	pending := NewStoreReminderStore(store.NewMemory())
+	for _, number := range []int{1, 2} {
+		_ = pending.Put(PendingReview{
+			Repository:  testRepo,
+			PullRequest: &github.PullRequest{Number: number},
+			Reviewer:    &github.User{Login: "alice"},
+			RequestedAt: time.Now(),
+		})
+	}
+
+	pools := &ReviewerPools{Pools: []ReviewerPool{
+		{Repositories: []string{"geckoboard/*"}, Reviewers: []string{"alice", "bob", "carol"}, Strategy: AssignLeastLoaded, ReviewersPerPullRequest: 2},
+	}}
+	api := &fakeReviewerAPI{}
+	a := NewAssigner(api, pools, pending, &fakeReassignNotifier{}, AssignRequest)
+
+	if err := a.Assign(context.Background(), testRepo, testPR); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"bob", "carol"}; !reflect.DeepEqual(api.requested, want) {
+		t.Errorf("expected %v to be asked, got: %v", want, api.requested)
+	}
+}
+
+func TestAssignerPrefersOwnersAndFallsBackToAwayReviewers(t *testing.T) {
+	pools := &ReviewerPools{Pools: []ReviewerPool{{
+		Repositories: []string{"geckoboard/*"},
+		Reviewers:    []string{"alice", "bob"},
+		Owners:       []PathOwners{{Paths: []string{"/db/"}, Reviewers: []string{"dba"}}},
+	}}}
+	api := &fakeReviewerAPI{files: []string{"db/migrations/1.sql", "main.go"}}
+	notifier := &fakeReassignNotifier{away: []string{"dba"}}
+	a := NewAssigner(api, pools, NewStoreReminderStore(store.NewMemory()), notifier, AssignSuggest)
+
+	if err := a.Assign(context.Background(), testRepo, testPR); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(api.requested) != 0 {
+		t.Errorf("expected nobody to be asked while suggesting, got: %v", api.requested)
+	}
+	if len(notifier.suggested) != 1 || len(notifier.suggested[0]) != 1 || notifier.suggested[0][0].Login != "dba" {
+		t.Errorf("expected the owner to be suggested, got: %#v", notifier.suggested)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/geckoboard/cake-bot/ctx"
+	"github.com/geckoboard/cake-bot/github"
+)
+
+// CommentHandler is called with a batch of comments and the IDs of the GitHub
+// deliveries they arrived in.
+type CommentHandler func(c context.Context, comments []*github.Comment, deliveries []string) error
+
+// CommentBatcher groups review comments that arrive close together, so that a
+// review with many comments produces a single notification.
+type CommentBatcher struct {
+	delay time.Duration
+
+	mu      sync.Mutex
+	batches map[string]*commentBatch
+}
+
+type commentBatch struct {
+	c          context.Context
+	handler    CommentHandler
+	comments   []*github.Comment
+	deliveries []string
+	timer      *time.Timer
+}
+
+// NewCommentBatcher instantiates a CommentBatcher that hands a batch over once
+// no comment has been added to it for delay.
+func NewCommentBatcher(delay time.Duration) *CommentBatcher {
+	return &CommentBatcher{
+		delay:   delay,
+		batches: make(map[string]*commentBatch),
+	}
+}
+
+// Add adds the comment, which arrived in the given GitHub delivery, to the
+// batch identified by key. The context and handler of the first comment in a
+// batch are used to deliver it.
+func (b *CommentBatcher) Add(c context.Context, key, deliveryID string, comment *github.Comment, handler CommentHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if batch, ok := b.batches[key]; ok {
+		batch.comments = append(batch.comments, comment)
+		batch.deliveries = append(batch.deliveries, deliveryID)
+		batch.timer.Reset(b.delay)
+		return
+	}
+
+	batch := &commentBatch{c: c, handler: handler, comments: []*github.Comment{comment}, deliveries: []string{deliveryID}}
+	batch.timer = time.AfterFunc(b.delay, func() { b.flush(key, batch) })
+	b.batches[key] = batch
+}
+
+// Flush hands over every pending batch straight away.
+func (b *CommentBatcher) Flush() {
+	b.mu.Lock()
+	batches := b.batches
+	b.batches = make(map[string]*commentBatch)
+	b.mu.Unlock()
+
+	// Whoever removes a batch from the map delivers it, so a timer firing
+	// now will find nothing to do.
+	for _, batch := range batches {
+		batch.timer.Stop()
+		b.deliver(batch)
+	}
+}
+
+func (b *CommentBatcher) flush(key string, batch *commentBatch) {
+	b.mu.Lock()
+	if b.batches[key] != batch {
+		// Already flushed.
+		b.mu.Unlock()
+		return
+	}
+	delete(b.batches, key)
+	b.mu.Unlock()
+
+	b.deliver(batch)
+}
+
+func (b *CommentBatcher) deliver(batch *commentBatch) {
+	if err := batch.handler(batch.c, batch.comments, batch.deliveries); err != nil {
+		ctx.Logger(batch.c).Error("at", "comment_batch_error", "err", err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/geckoboard/cake-bot/github"
+)
+
+func TestCommentBatcher(t *testing.T) {
+	b := NewCommentBatcher(20 * time.Millisecond)
+	batches := make(chan []*github.Comment, 2)
+	handler := func(_ context.Context, comments []*github.Comment, _ []string) error {
+		batches <- comments
+		return nil
+	}
+
+	for i := 1; i <= 3; i++ {
+		b.Add(context.Background(), "review-1", "", &github.Comment{ID: i}, handler)
+	}
+	b.Add(context.Background(), "review-2", "", &github.Comment{ID: 4}, handler)
+
+	sizes := map[int]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case comments := <-batches:
+			sizes[len(comments)] = true
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for batches")
+		}
+	}
+
+	if !sizes[3] || !sizes[1] {
+		t.Fatalf("expected a batch of 3 comments and a batch of 1, got sizes %v", sizes)
+	}
+}
+
+func TestCommentBatcherFlush(t *testing.T) {
+	b := NewCommentBatcher(time.Hour)
+
+	var delivered []*github.Comment
+	handler := func(_ context.Context, comments []*github.Comment, _ []string) error {
+		delivered = append(delivered, comments...)
+		return nil
+	}
+
+	b.Add(context.Background(), "review-1", "", &github.Comment{ID: 1}, handler)
+	b.Add(context.Background(), "review-1", "", &github.Comment{ID: 2}, handler)
+	b.Flush()
+
+	if len(delivered) != 2 {
+		t.Fatalf("expected pending comments to be delivered on flush, got %v", delivered)
+	}
+
+	// Nothing is left to deliver.
+	b.Flush()
+	if len(delivered) != 2 {
+		t.Fatalf("expected comments to be delivered once, got %v", delivered)
+	}
+}
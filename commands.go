@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/geckoboard/cake-bot/github"
+	"github.com/geckoboard/cake-bot/slack"
+	slackapi "github.com/slack-go/slack"
+)
+
+// maxSnooze is the longest someone can snooze for at once.
+const maxSnooze = 7 * 24 * time.Hour
+
+const slashCommandUsage = "*Usage:*\n" +
+	"• `/cake queue` lists the pull requests waiting for your review\n" +
+	"• `/cake mine` lists your pull requests waiting for a review\n" +
+	"• `/cake stats` shows the review leaderboard of the last week\n" +
+	"• `/cake snooze 2h` holds direct messages and reminders, `/cake snooze off` stops"
+
+// Snoozer holds direct messages and reminders for a user. *SlackNotifier
+// implements it.
+type Snoozer interface {
+	Snooze(user *github.User, until time.Time)
+}
+
+// SlashCommands answers the /cake slash command with messages that only the
+// person who used it can see.
+type SlashCommands struct {
+	pending ReminderStore
+	stats   *Stats
+	snoozer Snoozer
+
+	// githubLogin returns the GitHub login of the Slack user with the ID.
+	githubLogin func(slackID string) string
+	now         func() time.Time
+}
+
+func NewSlashCommands(pending ReminderStore, stats *Stats, snoozer Snoozer) *SlashCommands {
+	return &SlashCommands{
+		pending:     pending,
+		stats:       stats,
+		snoozer:     snoozer,
+		githubLogin: slack.Users.FindGitHubUsername,
+		now:         time.Now,
+	}
+}
+
+// Handle returns the reply to the command.
+func (s *SlashCommands) Handle(c context.Context, cmd slackapi.SlashCommand) (*slackapi.Msg, error) {
+	args := strings.Fields(strings.ToLower(cmd.Text))
+	if len(args) == 0 || args[0] == "help" {
+		return ephemeral(buildTextMessageBlock(slashCommandUsage)), nil
+	}
+
+	if args[0] == "stats" {
+		board, err := s.stats.Leaderboard(s.now().AddDate(0, 0, -7))
+		if err != nil {
+			return nil, err
+		}
+		return ephemeral(leaderboardBlocks(board)...), nil
+	}
+
+	login := s.githubLogin(cmd.UserID)
+	if login == "" {
+		return ephemeral(buildTextMessageBlock(
+			":question: I don't know who you are on GitHub. Add your GitHub username to the `github` field of your Slack profile.",
+		)), nil
+	}
+	user := &github.User{Login: login}
+
+	switch args[0] {
+	case "queue":
+		return s.queue(user)
+	case "mine":
+		return s.mine(user)
+	case "snooze":
+		return s.snooze(user, args[1:]), nil
+	}
+	return ephemeral(buildTextMessageBlock(fmt.Sprintf("I don't know how to `%s`.\n%s", args[0], slashCommandUsage))), nil
+}
+
+// queue lists the review requests waiting for the user.
+func (s *SlashCommands) queue(user *github.User) (*slackapi.Msg, error) {
+	reviews, err := s.pendingReviews(func(review PendingReview) bool {
+		return strings.EqualFold(review.Reviewer.Login, user.Login)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(reviews) == 0 {
+		return ephemeral(buildTextMessageBlock(":tada: Nothing is waiting for your review")), nil
+	}
+
+	header := fmt.Sprintf(":coffee: *You have %s waiting for your review*", plural(len(reviews), "pull request"))
+	return ephemeral(buildTextMessageBlock(header), buildTextMessageBlock(pendingReviewLines(reviews, s.now()))), nil
+}
+
+// mine lists the user's pull requests that are waiting for a review, with
+// who they are waiting for.
+func (s *SlashCommands) mine(user *github.User) (*slackapi.Msg, error) {
+	reviews, err := s.pendingReviews(func(review PendingReview) bool {
+		return review.PullRequest.User != nil && strings.EqualFold(review.PullRequest.User.Login, user.Login)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(reviews) == 0 {
+		return ephemeral(buildTextMessageBlock("None of your pull requests are waiting for a review")), nil
+	}
+
+	var (
+		keys      []PullRequestKey
+		byRequest = make(map[PullRequestKey][]PendingReview)
+	)
+	for _, review := range reviews {
+		if _, ok := byRequest[review.Key()]; !ok {
+			keys = append(keys, review.Key())
+		}
+		byRequest[review.Key()] = append(byRequest[review.Key()], review)
+	}
+
+	var lines []string
+	for _, key := range keys {
+		waiting := byRequest[key]
+
+		names := make([]string, len(waiting))
+		for i, review := range waiting {
+			names[i] = fmt.Sprint(buildUserName(review.Reviewer))
+		}
+		lines = append(lines, fmt.Sprintf(
+			"• %s, waiting %s for %s",
+			prLink(waiting[0].PullRequest.HTMLURL, waiting[0].Repository, waiting[0].PullRequest),
+			formatAge(s.now().Sub(waiting[0].RequestedAt)), strings.Join(names, ", "),
+		))
+	}
+
+	header := fmt.Sprintf(":hourglass: *%s waiting for a review*", plural(len(keys), "pull request"))
+	return ephemeral(buildTextMessageBlock(header), buildTextMessageBlock(strings.Join(lines, "\n"))), nil
+}
+
+// snooze holds the user's direct messages and reminders for the duration
+// given in args, e.g. "2h" or "30m", or stops if it is "off".
+func (s *SlashCommands) snooze(user *github.User, args []string) *slackapi.Msg {
+	if len(args) == 1 && args[0] == "off" {
+		s.snoozer.Snooze(user, time.Time{})
+		return ephemeral(buildTextMessageBlock(":wave: You are no longer snoozing"))
+	}
+
+	var d time.Duration
+	if len(args) == 1 {
+		d, _ = time.ParseDuration(args[0])
+	}
+	if d <= 0 || d > maxSnooze {
+		return ephemeral(buildTextMessageBlock("Snooze for how long? e.g. `/cake snooze 2h`, for up to a week"))
+	}
+
+	until := s.now().Add(d)
+	s.snoozer.Snooze(user, until)
+
+	text := fmt.Sprintf(
+		":zzz: Direct messages and reminders are snoozed until <!date^%d^{date_short_pretty} at {time}|%s>",
+		until.Unix(), until.UTC().Format("Mon 15:04 MST"),
+	)
+	return ephemeral(buildTextMessageBlock(text))
+}
+
+// pendingReviews returns the pending reviews that match, oldest first and
+// then by reviewer.
+func (s *SlashCommands) pendingReviews(match func(PendingReview) bool) ([]PendingReview, error) {
+	all, err := s.pending.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var reviews []PendingReview
+	for _, review := range all {
+		if match(review) {
+			reviews = append(reviews, review)
+		}
+	}
+	sort.Slice(reviews, func(i, j int) bool {
+		if !reviews[i].RequestedAt.Equal(reviews[j].RequestedAt) {
+			return reviews[i].RequestedAt.Before(reviews[j].RequestedAt)
+		}
+		return strings.ToLower(reviews[i].Reviewer.Login) < strings.ToLower(reviews[j].Reviewer.Login)
+	})
+	return reviews, nil
+}
+
+// ephemeral builds a reply that only the person who used the command can see.
+func ephemeral(blocks ...slackapi.Block) *slackapi.Msg {
+	return &slackapi.Msg{
+		ResponseType: slackapi.ResponseTypeEphemeral,
+		Blocks:       slackapi.Blocks{BlockSet: blocks},
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geckoboard/cake-bot/github"
+	"github.com/geckoboard/cake-bot/store"
+	slackapi "github.com/slack-go/slack"
+)
+
+type fakeSnoozer struct {
+	until map[string]time.Time
+}
+
+func (f *fakeSnoozer) Snooze(user *github.User, until time.Time) {
+	f.until[user.Login] = until
+}
+
+func newTestSlashCommands(t *testing.T) (*SlashCommands, *fakeSnoozer) {
+	t.Helper()
+
+	requestedAt := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	pending := NewStoreReminderStore(store.NewMemory())
+	other := &github.PullRequest{Number: 13, Title: "Add more cake", User: &github.User{Login: "reviewer"}}
+	for _, review := range []PendingReview{
+		{Repository: testRepo, PullRequest: testPR, Reviewer: testReview.User, RequestedAt: requestedAt},
+		{Repository: testRepo, PullRequest: other, Reviewer: &github.User{Login: "alice"}, RequestedAt: requestedAt.Add(time.Hour)},
+		{Repository: testRepo, PullRequest: other, Reviewer: &github.User{Login: "bob"}, RequestedAt: requestedAt.Add(time.Hour)},
+	} {
+		if err := pending.Put(review); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snoozer := &fakeSnoozer{until: map[string]time.Time{}}
+	commands := NewSlashCommands(pending, NewStats(NewStoreStatsStore(store.NewMemory()), pending), snoozer)
+	commands.now = func() time.Time { return requestedAt.Add(3 * time.Hour) }
+	commands.githubLogin = func(slackID string) string {
+		if slackID == "U2147483697" {
+			return "reviewer"
+		}
+		return ""
+	}
+	return commands, snoozer
+}
+
+func handleCommand(t *testing.T, commands *SlashCommands, userID, text string) string {
+	t.Helper()
+
+	msg, err := commands.Handle(context.Background(), slackapi.SlashCommand{Command: "/cake", UserID: userID, Text: text})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.ResponseType != slackapi.ResponseTypeEphemeral {
+		t.Errorf("expected an ephemeral reply to %q, got %q", text, msg.ResponseType)
+	}
+
+	raw, err := json.Marshal(msg.Blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blocks(t, url.Values{"blocks": {string(raw)}})
+}
+
+func TestSlashCommands(t *testing.T) {
+	commands, snoozer := newTestSlashCommands(t)
+
+	cases := []struct {
+		text string
+		want []string
+	}{
+		{"queue", []string{"You have 1 pull request waiting for your review", "<|cake-bot#12> - Add cake, requested 3 hours ago"}},
+		{"mine", []string{"1 pull request waiting for a review", "<|cake-bot#13> - Add more cake, waiting 2 hours for alice, bob"}},
+		{"stats", []string{"Review leaderboard since Mon 25 Dec", "*Waiting longest*"}},
+		{"snooze 2h", []string{"snoozed until <!date^1704117600^{date_short_pretty} at {time}|Mon 14:00 UTC>"}},
+		{"snooze forever", []string{"Snooze for how long?"}},
+		{"", []string{"/cake queue"}},
+		{"bake", []string{"I don't know how to `bake`"}},
+	}
+
+	for _, c := range cases {
+		b := handleCommand(t, commands, "U2147483697", c.text)
+		for _, want := range c.want {
+			if !strings.Contains(b, want) {
+				t.Errorf("expected the reply to %q to contain %q, got blocks: %s", c.text, want, b)
+			}
+		}
+	}
+
+	if until := snoozer.until["reviewer"]; !until.Equal(commands.now().Add(2 * time.Hour)) {
+		t.Errorf("expected the reviewer to be snoozed for 2 hours, got: %v", until)
+	}
+}
+
+func TestSlashCommandsFromUnknownUser(t *testing.T) {
+	commands, _ := newTestSlashCommands(t)
+
+	if b := handleCommand(t, commands, "U0", "queue"); !strings.Contains(b, "I don't know who you are on GitHub") {
+		t.Errorf("expected the user to be asked to set their GitHub username, got blocks: %s", b)
+	}
+}
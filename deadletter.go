@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/geckoboard/cake-bot/github"
+	"github.com/geckoboard/cake-bot/store"
+)
+
+// DeadLetter is a notification that could not be delivered to Slack, with
+// enough information to replay it.
+type DeadLetter struct {
+	// ID identifies the notification in the DeadLetterLog it was listed
+	// from.
+	ID string `json:"-"`
+
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	Err    string    `json:"err"`
+
+	Repository  *github.Repository  `json:"repository,omitempty"`
+	PullRequest *github.PullRequest `json:"pull_request,omitempty"`
+	User        *github.User        `json:"user,omitempty"`
+	Sender      *github.User        `json:"sender,omitempty"`
+	Team        *github.Team        `json:"team,omitempty"`
+	Comments    []*github.Comment   `json:"comments,omitempty"`
+	Review      *github.Review      `json:"review,omitempty"`
+}
+
+// Replay sends the notification again using notifier.
+func (d DeadLetter) Replay(c context.Context, notifier Notifier) error {
+	switch d.Method {
+	case "ReviewRequested":
+		return notifier.ReviewRequested(c, d.Repository, d.PullRequest, d.User)
+	case "TeamReviewRequested":
+		return notifier.TeamReviewRequested(c, d.Repository, d.PullRequest, d.Team)
+	case "Approved":
+		return notifier.Approved(c, d.Repository, d.PullRequest, d.Review)
+	case "ChangesRequested":
+		return notifier.ChangesRequested(c, d.Repository, d.PullRequest, d.Review)
+	case "Commented":
+		return notifier.Commented(c, d.Repository, d.PullRequest, d.Review)
+	case "ReviewEdited":
+		return notifier.ReviewEdited(c, d.Repository, d.PullRequest, d.Review)
+	case "ReviewDismissed":
+		return notifier.ReviewDismissed(c, d.Repository, d.PullRequest, d.Review, d.Sender)
+	case "ReviewRequestRemoved":
+		return notifier.ReviewRequestRemoved(c, d.Repository, d.PullRequest, d.User, d.Sender)
+	case "Merged":
+		return notifier.Merged(c, d.Repository, d.PullRequest, d.Sender)
+	case "Closed":
+		return notifier.Closed(c, d.Repository, d.PullRequest, d.Sender)
+	case "CommentsPosted":
+		return notifier.CommentsPosted(c, d.Repository, d.PullRequest, d.Comments)
+	default:
+		return fmt.Errorf("unknown dead letter method %q", d.Method)
+	}
+}
+
+// DeadLetterLog stores notifications that ran out of delivery attempts.
+type DeadLetterLog interface {
+	// Add logs the notification, replacing the one with the same ID if it
+	// has one.
+	Add(DeadLetter) error
+	// List returns the logged notifications, oldest first, with their IDs.
+	List() ([]DeadLetter, error)
+	Remove(id string) error
+}
+
+// StoreDeadLetterLog is a DeadLetterLog kept in the dead letters bucket of a
+// store.Store.
+type StoreDeadLetterLog struct {
+	store store.Store
+
+	// added tells apart the notifications logged at the same time.
+	added atomic.Int64
+}
+
+func NewStoreDeadLetterLog(s store.Store) *StoreDeadLetterLog {
+	return &StoreDeadLetterLog{store: s}
+}
+
+func (l *StoreDeadLetterLog) Add(letter DeadLetter) error {
+	if letter.ID == "" {
+		// Keyed by time, so that they are listed oldest first.
+		letter.ID = fmt.Sprintf("%s|%d", store.TimeKey(letter.Time), l.added.Add(1))
+	}
+	return store.PutJSON(l.store, store.DeadLetters, letter.ID, letter)
+}
+
+func (l *StoreDeadLetterLog) List() ([]DeadLetter, error) {
+	var letters []DeadLetter
+	err := l.store.Scan(store.DeadLetters, "", func(id string, value []byte) error {
+		var letter DeadLetter
+		if err := json.Unmarshal(value, &letter); err != nil {
+			return err
+		}
+		letter.ID = id
+		letters = append(letters, letter)
+		return nil
+	})
+	return letters, err
+}
+
+func (l *StoreDeadLetterLog) Remove(id string) error {
+	return l.store.Delete(store.DeadLetters, id)
+}
+
+// ReplayDeadLetters replays every logged notification, removing the ones that
+// are sent and keeping the ones that fail again with their new error. It
+// returns how many were replayed successfully.
+func ReplayDeadLetters(c context.Context, deadLetters DeadLetterLog, notifier Notifier) (int, error) {
+	letters, err := deadLetters.List()
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for _, letter := range letters {
+		if err := letter.Replay(c, notifier); err != nil {
+			letter.Err = err.Error()
+			if err := deadLetters.Add(letter); err != nil {
+				return replayed, err
+			}
+			continue
+		}
+		if err := deadLetters.Remove(letter.ID); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	return replayed, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/geckoboard/cake-bot/store"
+)
+
+// DeliveryCache remembers which GitHub deliveries have already been handled,
+// so that redelivered webhooks don't notify Slack twice.
+type DeliveryCache interface {
+	// Seen records the delivery ID and reports whether it had already been
+	// recorded.
+	Seen(id string) (bool, error)
+	// Forget drops the delivery ID, so that a redelivery is handled again.
+	Forget(id string) error
+}
+
+// expireDeliveriesEvery is how many deliveries a StoreDeliveryCache records
+// between dropping the expired ones.
+const expireDeliveriesEvery = 1000
+
+// StoreDeliveryCache is a DeliveryCache kept in the deliveries bucket of a
+// store.Store, holding each delivery ID for at most ttl.
+type StoreDeliveryCache struct {
+	store store.Store
+	ttl   time.Duration
+	now   func() time.Time
+
+	// seen counts the deliveries since the expired ones were last dropped.
+	seen atomic.Int64
+}
+
+// NewStoreDeliveryCache instantiates a new StoreDeliveryCache, dropping the
+// delivery IDs that have expired since it was last used. They are dropped
+// again every expireDeliveriesEvery deliveries.
+func NewStoreDeliveryCache(s store.Store, ttl time.Duration) (*StoreDeliveryCache, error) {
+	c := &StoreDeliveryCache{store: s, ttl: ttl, now: time.Now}
+	return c, c.Expire()
+}
+
+func (c *StoreDeliveryCache) Seen(id string) (bool, error) {
+	if c.seen.Add(1)%expireDeliveriesEvery == 0 {
+		if err := c.Expire(); err != nil {
+			return false, err
+		}
+	}
+
+	now := c.now()
+
+	var seenAt time.Time
+	seen := false
+	err := store.UpdateJSON(c.store, store.Deliveries, id, &seenAt, func(exists bool) (bool, error) {
+		if exists && now.Sub(seenAt) < c.ttl {
+			seen = true
+			return true, nil
+		}
+		seenAt = now
+		return true, nil
+	})
+	return seen, err
+}
+
+func (c *StoreDeliveryCache) Forget(id string) error {
+	return c.store.Delete(store.Deliveries, id)
+}
+
+// Expire drops the delivery IDs older than the TTL.
+func (c *StoreDeliveryCache) Expire() error {
+	now := c.now()
+
+	var expired []string
+	err := c.store.Scan(store.Deliveries, "", func(id string, value []byte) error {
+		var seenAt time.Time
+		if err := json.Unmarshal(value, &seenAt); err != nil {
+			return err
+		}
+		if now.Sub(seenAt) >= c.ttl {
+			expired = append(expired, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range expired {
+		if err := c.store.Delete(store.Deliveries, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/geckoboard/cake-bot/store"
+)
+
+// newTestDeliveryCache returns an empty DeliveryCache holding deliveries for
+// an hour.
+func newTestDeliveryCache(t *testing.T) *StoreDeliveryCache {
+	t.Helper()
+	cache, err := NewStoreDeliveryCache(store.NewMemory(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+func TestStoreDeliveryCache(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	db := store.NewMemory()
+
+	cache, err := NewStoreDeliveryCache(db, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.now = func() time.Time { return now }
+
+	assertSeen := func(id string, expected bool) {
+		t.Helper()
+		seen, err := cache.Seen(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen != expected {
+			t.Fatalf("expected Seen(%q) to be %v, got %v", id, expected, seen)
+		}
+	}
+
+	assertSeen("a", false)
+	assertSeen("a", true)
+
+	// Deliveries are forgotten once the TTL has passed.
+	now = now.Add(time.Hour)
+	assertSeen("a", false)
+	assertSeen("a", true)
+
+	// Expired deliveries are dropped.
+	now = now.Add(2 * time.Hour)
+	if err := cache.Expire(); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := db.Get(store.Deliveries, "a"); value != nil {
+		t.Errorf("expected the expired delivery to be dropped, got: %s", value)
+	}
+}
+
+func TestStoreDeliveryCacheExpiresPeriodically(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	db := store.NewMemory()
+
+	cache, err := NewStoreDeliveryCache(db, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.now = func() time.Time { return now }
+
+	if _, err := cache.Seen("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	for i := 1; i < expireDeliveriesEvery; i++ {
+		if _, err := cache.Seen("b"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if value, _ := db.Get(store.Deliveries, "a"); value != nil {
+		t.Errorf("expected the expired delivery to be dropped, got: %s", value)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/geckoboard/cake-bot/github"
+)
+
+// DigestNotifier sends digests of the review requests that are still pending.
+type DigestNotifier interface {
+	ChannelDigest(c context.Context, channel string, reviews []PendingReview) error
+	UserDigest(c context.Context, user *github.User, reviews []PendingReview) error
+}
+
+// Digest summarises the pending reviews for each channel they are routed to,
+// and for the reviewers that opted into a digest of their own.
+type Digest struct {
+	store    ReminderStore
+	router   *ChannelRouter
+	notifier DigestNotifier
+
+	// users are the GitHub logins of the reviewers that get a digest.
+	users []string
+}
+
+func NewDigest(store ReminderStore, router *ChannelRouter, notifier DigestNotifier, users []string) *Digest {
+	return &Digest{store: store, router: router, notifier: notifier, users: users}
+}
+
+// Send sends every digest that has at least one pending review in it.
+func (d *Digest) Send(c context.Context) error {
+	reviews, err := d.store.List()
+	if err != nil {
+		return err
+	}
+
+	var (
+		channels []string
+		byChan   = make(map[string][]PendingReview)
+	)
+	for _, review := range reviews {
+		for _, channel := range d.router.Channels(review.Repository, review.PullRequest) {
+			if _, ok := byChan[channel]; !ok {
+				channels = append(channels, channel)
+			}
+			byChan[channel] = append(byChan[channel], review)
+		}
+	}
+
+	var errs []error
+	for _, channel := range channels {
+		if err := d.notifier.ChannelDigest(c, channel, byChan[channel]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, login := range d.users {
+		mine := slices.DeleteFunc(slices.Clone(reviews), func(review PendingReview) bool {
+			return !strings.EqualFold(review.Reviewer.Login, login)
+		})
+		if len(mine) == 0 {
+			continue
+		}
+
+		if err := d.notifier.UserDigest(c, mine[0].Reviewer, mine); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
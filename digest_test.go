@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/geckoboard/cake-bot/github"
+	"github.com/geckoboard/cake-bot/store"
+)
+
+type fakeDigestNotifier struct {
+	channels map[string][]PendingReview
+	users    map[string][]PendingReview
+}
+
+func (f *fakeDigestNotifier) ChannelDigest(_ context.Context, channel string, reviews []PendingReview) error {
+	f.channels[channel] = reviews
+	return nil
+}
+
+func (f *fakeDigestNotifier) UserDigest(_ context.Context, user *github.User, reviews []PendingReview) error {
+	f.users[user.Login] = reviews
+	return nil
+}
+
+func TestDigestSend(t *testing.T) {
+	store := NewStoreReminderStore(store.NewMemory())
+	router := &ChannelRouter{
+		Default: []string{"#devs"},
+		Routes:  []ChannelRoute{{Repositories: []string{"geckoboard/api"}, Channels: []string{"#api"}}},
+	}
+	notifier := &fakeDigestNotifier{channels: map[string][]PendingReview{}, users: map[string][]PendingReview{}}
+
+	api := &github.Repository{Name: "api", FullName: "geckoboard/api"}
+	other := &github.User{Login: "other"}
+	_ = store.Put(PendingReview{Repository: testRepo, PullRequest: testPR, Reviewer: testReview.User})
+	_ = store.Put(PendingReview{Repository: api, PullRequest: testPR, Reviewer: testReview.User})
+	_ = store.Put(PendingReview{Repository: api, PullRequest: testPR, Reviewer: other})
+
+	d := NewDigest(store, router, notifier, []string{"Reviewer", "nobody"})
+	if err := d.Send(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(notifier.channels) != 2 || len(notifier.channels["#devs"]) != 1 || len(notifier.channels["#api"]) != 2 {
+		t.Errorf("expected the reviews to be grouped by channel, got: %#v", notifier.channels)
+	}
+
+	if len(notifier.users) != 1 || len(notifier.users["reviewer"]) != 2 {
+		t.Errorf("expected a digest for the subscribed reviewer only, got: %#v", notifier.users)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import "fmt"
+
+// DraftPolicy decides what happens to review requests on draft pull requests,
+// which reviewers usually can't act on yet.
+type DraftPolicy string
+
+const (
+	// DraftNotify notifies about review requests on drafts straight away.
+	DraftNotify DraftPolicy = "notify"
+	// DraftSuppress never notifies about review requests made on drafts.
+	DraftSuppress DraftPolicy = "suppress"
+	// DraftDefer notifies about the review requests of a draft once it is
+	// marked as ready for review.
+	DraftDefer DraftPolicy = "defer"
+)
+
+// ParseDraftPolicy returns the DraftPolicy named by s.
+func ParseDraftPolicy(s string) (DraftPolicy, error) {
+	switch p := DraftPolicy(s); p {
+	case DraftNotify, DraftSuppress, DraftDefer:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown draft policy %q, expected notify, suppress or defer", s)
+}
@@ -0,0 +1,224 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBaseURL = "https://api.github.com"
+	// defaultTimeout bounds every request, on top of the deadline of its
+	// context.
+	defaultTimeout = 10 * time.Second
+)
+
+// Client is a small client for the parts of the GitHub REST API that cake-bot
+// uses.
+type Client struct {
+	token      string
+	baseURL    string
+	httpClient *http.Client
+}
+
+// ClientOption configures optional behaviour of the Client.
+type ClientOption func(*Client)
+
+// WithBaseURL makes the Client send requests to another API server, e.g.
+// GitHub Enterprise or a test server.
+func WithBaseURL(url string) ClientOption {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// NewClient instantiates a Client that authenticates with token.
+func NewClient(token string, opts ...ClientOption) *Client {
+	c := &Client{
+		token:      token,
+		baseURL:    defaultBaseURL,
+		httpClient: &http.Client{Timeout: defaultTimeout},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// APIError is returned when GitHub responds with an error status.
+type APIError struct {
+	StatusCode int
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("github: %d %s", e.StatusCode, e.Message)
+}
+
+// RateLimited reports whether GitHub refused the request because a rate limit
+// was exceeded, which it does with a 403 or a 429.
+func (e *APIError) RateLimited() bool {
+	return e.StatusCode == http.StatusForbidden || e.StatusCode == http.StatusTooManyRequests
+}
+
+// PullRequest fetches a pull request of the repository, given by its full
+// name such as "geckoboard/cake-bot".
+func (c *Client) PullRequest(ctx context.Context, repo string, number int) (*PullRequest, error) {
+	var pr PullRequest
+	if err := c.do(ctx, "GET", fmt.Sprintf("/repos/%s/pulls/%d", repo, number), nil, &pr); err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+// PullRequestFiles lists the paths of the files changed by the pull request.
+// GitHub lists at most 3000 files.
+func (c *Client) PullRequestFiles(ctx context.Context, repo string, number int) ([]string, error) {
+	const perPage = 100
+
+	var paths []string
+	for page := 1; ; page++ {
+		var files []struct {
+			Filename string `json:"filename"`
+		}
+		path := fmt.Sprintf("/repos/%s/pulls/%d/files?per_page=%d&page=%d", repo, number, perPage, page)
+		if err := c.do(ctx, "GET", path, nil, &files); err != nil {
+			return nil, err
+		}
+
+		for _, f := range files {
+			paths = append(paths, f.Filename)
+		}
+		if len(files) < perPage {
+			return paths, nil
+		}
+	}
+}
+
+// RequestReviewers asks the users to review the pull request.
+func (c *Client) RequestReviewers(ctx context.Context, repo string, number int, logins []string) error {
+	body := map[string][]string{"reviewers": logins}
+	return c.do(ctx, "POST", fmt.Sprintf("/repos/%s/pulls/%d/requested_reviewers", repo, number), body, nil)
+}
+
+// RemoveRequestedReviewers withdraws the review requests of the users.
+func (c *Client) RemoveRequestedReviewers(ctx context.Context, repo string, number int, logins []string) error {
+	body := map[string][]string{"reviewers": logins}
+	return c.do(ctx, "DELETE", fmt.Sprintf("/repos/%s/pulls/%d/requested_reviewers", repo, number), body, nil)
+}
+
+// User fetches the public profile of the user with the login.
+func (c *Client) User(ctx context.Context, login string) (*User, error) {
+	var user User
+	if err := c.do(ctx, "GET", "/users/"+url.PathEscape(login), nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// CommitEmails returns the author emails of the user's most recent commits.
+// GitHub only attributes commits to a user when their email is verified, so
+// these are verified emails of the user.
+func (c *Client) CommitEmails(ctx context.Context, login string) ([]string, error) {
+	var result struct {
+		Items []struct {
+			Author *User `json:"author"`
+			Commit struct {
+				Author struct {
+					Email string `json:"email"`
+				} `json:"author"`
+			} `json:"commit"`
+		} `json:"items"`
+	}
+	path := "/search/commits?sort=author-date&order=desc&per_page=30&q=" + url.QueryEscape("author:"+login)
+	if err := c.do(ctx, "GET", path, nil, &result); err != nil {
+		return nil, err
+	}
+
+	var emails []string
+	for _, item := range result.Items {
+		if item.Author != nil && strings.EqualFold(item.Author.Login, login) {
+			emails = append(emails, item.Commit.Author.Email)
+		}
+	}
+	return emails, nil
+}
+
+// UserEmails returns the emails of the user: the one in their public profile,
+// then the verified ones of their recent commits. GitHub's noreply addresses
+// are left out, and each email is only returned once. Users that don't exist,
+// such as bots, have none.
+func (c *Client) UserEmails(ctx context.Context, login string) ([]string, error) {
+	user, err := c.User(ctx, login)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	commitEmails, err := c.CommitEmails(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	var emails []string
+	seen := map[string]bool{}
+	for _, email := range append([]string{user.Email}, commitEmails...) {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email == "" || seen[email] || strings.HasSuffix(email, "@users.noreply.github.com") {
+			continue
+		}
+		seen[email] = true
+		emails = append(emails, email)
+	}
+	return emails, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		_ = json.NewDecoder(resp.Body).Decode(apiErr)
+		return apiErr
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
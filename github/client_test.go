@@ -0,0 +1,138 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestClientRequestReviewers(t *testing.T) {
+	var got struct {
+		method, path, auth string
+		body               map[string][]string
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.method, got.path, got.auth = r.Method, r.URL.Path, r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&got.body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer s.Close()
+
+	c := NewClient("t0ken", WithBaseURL(s.URL))
+	if err := c.RequestReviewers(context.Background(), "geckoboard/cake-bot", 12, []string{"BRMatt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.method != "POST" || got.path != "/repos/geckoboard/cake-bot/pulls/12/requested_reviewers" {
+		t.Errorf("unexpected request %s %s", got.method, got.path)
+	}
+	if got.auth != "Bearer t0ken" {
+		t.Errorf("unexpected Authorization header %q", got.auth)
+	}
+	if !reflect.DeepEqual(got.body["reviewers"], []string{"BRMatt"}) {
+		t.Errorf("unexpected body %v", got.body)
+	}
+}
+
+func TestClientPullRequestFiles(t *testing.T) {
+	var pages []string
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		pages = append(pages, page)
+
+		var files []map[string]string
+		n := 100
+		if page == "2" {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			files = append(files, map[string]string{"filename": fmt.Sprintf("page%s/%d.go", page, i)})
+		}
+		_ = json.NewEncoder(w).Encode(files)
+	}))
+	defer s.Close()
+
+	files, err := NewClient("t0ken", WithBaseURL(s.URL)).PullRequestFiles(context.Background(), "geckoboard/cake-bot", 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(pages, []string{"1", "2"}) {
+		t.Errorf("expected 2 pages to be fetched, got: %v", pages)
+	}
+	if len(files) != 101 || files[0] != "page1/0.go" || files[100] != "page2/0.go" {
+		t.Errorf("unexpected files: %d files starting with %v", len(files), files[0])
+	}
+}
+
+func TestClientReturnsAPIErrors(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = w.Write([]byte(`{"message": "Reviews may only be requested from collaborators."}`))
+	}))
+	defer s.Close()
+
+	_, err := NewClient("t0ken", WithBaseURL(s.URL)).PullRequest(context.Background(), "geckoboard/cake-bot", 12)
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 422 || apiErr.Message != "Reviews may only be requested from collaborators." {
+		t.Fatalf("expected an APIError, got: %v", err)
+	}
+	if apiErr.RateLimited() {
+		t.Error("expected a 422 not to be a rate limit")
+	}
+	if !(&APIError{StatusCode: http.StatusTooManyRequests}).RateLimited() || !(&APIError{StatusCode: http.StatusForbidden}).RateLimited() {
+		t.Error("expected a 403 and a 429 to be rate limits")
+	}
+}
+
+func TestClientUserEmails(t *testing.T) {
+	var searches []string
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users/alice":
+			_, _ = w.Write([]byte(`{"login": "alice", "email": "Alice@example.com"}`))
+		case "/users/dependabot[bot]":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message": "Not Found"}`))
+		case "/search/commits":
+			searches = append(searches, r.URL.Query().Get("q"))
+			_, _ = w.Write([]byte(`{"items": [
+				{"author": {"login": "alice"}, "commit": {"author": {"email": "alice@example.com"}}},
+				{"author": {"login": "Alice"}, "commit": {"author": {"email": "alice@home.example"}}},
+				{"author": {"login": "alice"}, "commit": {"author": {"email": "1+alice@users.noreply.github.com"}}},
+				{"author": {"login": "mallory"}, "commit": {"author": {"email": "mallory@example.com"}}},
+				{"author": null, "commit": {"author": {"email": "unverified@example.com"}}}
+			]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	c := NewClient("t0ken", WithBaseURL(s.URL))
+
+	emails, err := c.UserEmails(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"alice@example.com", "alice@home.example"}; !reflect.DeepEqual(emails, want) {
+		t.Errorf("expected emails %v, got: %v", want, emails)
+	}
+	if !reflect.DeepEqual(searches, []string{"author:alice"}) {
+		t.Errorf("unexpected commit searches: %v", searches)
+	}
+
+	emails, err = c.UserEmails(context.Background(), "dependabot[bot]")
+	if err != nil || len(emails) != 0 {
+		t.Errorf("expected users that don't exist to have no emails, got: %v, %v", emails, err)
+	}
+}
@@ -1,10 +1,46 @@
 package github
 
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
 type PullRequest struct {
-	HTMLURL string `json:"html_url"`
-	Number  int    `json:"number"`
-	Title   string `json:"title"`
-	User    *User  `json:"user"`
+	HTMLURL string  `json:"html_url"`
+	Number  int     `json:"number"`
+	Title   string  `json:"title"`
+	User    *User   `json:"user"`
+	Labels  []Label `json:"labels"`
+	Base    *Branch `json:"base"`
+	Draft   bool    `json:"draft"`
+
+	// RequestedReviewers and RequestedTeams are the reviews that are still
+	// pending.
+	RequestedReviewers []*User `json:"requested_reviewers"`
+	RequestedTeams     []*Team `json:"requested_teams"`
+
+	// Merged and MergedBy are only meaningful once the pull request has
+	// been closed.
+	Merged   bool  `json:"merged"`
+	MergedBy *User `json:"merged_by"`
+}
+
+// BaseRef returns the name of the branch the pull request will be merged into.
+func (pr *PullRequest) BaseRef() string {
+	if pr.Base == nil {
+		return ""
+	}
+	return pr.Base.Ref
+}
+
+type Label struct {
+	Name string `json:"name"`
+}
+
+type Branch struct {
+	Ref string `json:"ref"`
+	SHA string `json:"sha"`
 }
 
 type Repository struct {
@@ -13,10 +49,14 @@ type Repository struct {
 }
 
 type Review struct {
-	ID   int   `json:"id"`
-	User *User `json:"user"`
+	ID          int       `json:"id"`
+	User        *User     `json:"user"`
+	Body        string    `json:"body"`
+	SubmittedAt time.Time `json:"submitted_at"`
+	CommitID    string    `json:"commit_id"`
 
-	// State can be either "approved" or "change_requested".
+	// State can be "approved", "changes_requested", "commented" or, once
+	// the review has been dismissed, "dismissed".
 	State string `json:"state"`
 
 	Links Links `json:"_links"`
@@ -26,13 +66,92 @@ func (r *Review) IsApproved() bool {
 	return r.State == "approved"
 }
 
+func (r *Review) IsChangesRequested() bool {
+	return r.State == "changes_requested"
+}
+
+func (r *Review) IsCommented() bool {
+	return r.State == "commented"
+}
+
 func (r *Review) HTMLURL() string {
 	return r.Links.GetURL("html")
 }
 
+type Team struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// Comment is a comment on a pull request. Review comments are attached to a
+// line of the diff, and have Path, DiffHunk and PullRequestReviewID set.
+type Comment struct {
+	ID        int       `json:"id"`
+	Body      string    `json:"body"`
+	User      *User     `json:"user"`
+	HTMLURL   string    `json:"html_url"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Path                string `json:"path"`
+	DiffHunk            string `json:"diff_hunk"`
+	PullRequestReviewID int    `json:"pull_request_review_id"`
+}
+
+var mentionPattern = regexp.MustCompile(`(^|[^\w@./])@([A-Za-z0-9][A-Za-z0-9-]*)(/[\w.-]+)?`)
+
+// Mentions returns the logins of the users @mentioned in the comment, without
+// duplicates. Team mentions such as @geckoboard/backend are ignored.
+func (c *Comment) Mentions() []string {
+	var logins []string
+	seen := make(map[string]bool)
+
+	for _, m := range mentionPattern.FindAllStringSubmatch(c.Body, -1) {
+		login, team := m[2], m[3]
+		if team != "" || seen[strings.ToLower(login)] {
+			continue
+		}
+		seen[strings.ToLower(login)] = true
+		logins = append(logins, login)
+	}
+	return logins
+}
+
+// Issue is an issue or pull request, as sent in issue_comment webhooks.
+type Issue struct {
+	HTMLURL string `json:"html_url"`
+	Number  int    `json:"number"`
+	Title   string `json:"title"`
+	User    *User  `json:"user"`
+
+	// PullRequest is only present if the issue is a pull request.
+	PullRequest *struct {
+		HTMLURL string `json:"html_url"`
+	} `json:"pull_request"`
+}
+
+func (i *Issue) IsPullRequest() bool {
+	return i.PullRequest != nil
+}
+
+// AsPullRequest returns the pull request fields that are known from the issue.
+func (i *Issue) AsPullRequest() *PullRequest {
+	return &PullRequest{
+		HTMLURL: i.HTMLURL,
+		Number:  i.Number,
+		Title:   i.Title,
+		User:    i.User,
+	}
+}
+
 type User struct {
 	Login string `json:"login"`
 	ID    int    `json:"id"`
+
+	// Name and Email are only in the public profile that Client.User
+	// fetches, and only if the user has made them public.
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
 }
 
 type Links map[string]struct {
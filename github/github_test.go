@@ -0,0 +1,26 @@
+package github
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCommentMentions(t *testing.T) {
+	cases := []struct {
+		body     string
+		expected []string
+	}{
+		{"Looks good", nil},
+		{"@BRMatt what do you think?", []string{"BRMatt"}},
+		{"cc @leo-cassarani, @BRMatt and @brmatt", []string{"leo-cassarani", "BRMatt"}},
+		{"Ask @geckoboard/backend or email dev@geckoboard.com", nil},
+		{"(@cake-bot)", []string{"cake-bot"}},
+	}
+
+	for _, tc := range cases {
+		got := (&Comment{Body: tc.body}).Mentions()
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("expected mentions in %q to be %v, got %v", tc.body, tc.expected, got)
+		}
+	}
+}
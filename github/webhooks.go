@@ -7,23 +7,44 @@ import (
 )
 
 const (
-	PullRequestEvent       = "pull_request"
-	PullRequestReviewEvent = "pull_request_review"
+	PullRequestEvent              = "pull_request"
+	PullRequestReviewEvent        = "pull_request_review"
+	PullRequestReviewCommentEvent = "pull_request_review_comment"
+	IssueCommentEvent             = "issue_comment"
 )
 
 type PullRequestWebhook struct {
 	// Action can be one of "assigned", "unassigned", "review_requested",
 	// "review_request_removed", "labeled", "unlabeled", "opened", "edited",
-	// "closed", or "reopened".
+	// "closed", "reopened", "ready_for_review" or "converted_to_draft".
 	Action string `json:"action"`
 
 	PullRequest *PullRequest `json:"pull_request"`
 	Repository  *Repository  `json:"repository"`
 	Sender      *User        `json:"sender"`
 
-	// If Action is "review_requested" or "review_request_removed",
-	// RequestedReviewer will be present.
+	// If Action is "review_requested" or "review_request_removed", either
+	// RequestedReviewer or RequestedTeam will be present.
 	RequestedReviewer *User `json:"requested_reviewer"`
+	RequestedTeam     *Team `json:"requested_team"`
+}
+
+func (w *PullRequestWebhook) Validate() error {
+	if w.PullRequest == nil {
+		return errors.New(`"pull_request" field is missing from webhook payload`)
+	}
+
+	if w.Repository == nil {
+		return errors.New(`"repository" field is missing from webhook payload`)
+	}
+
+	if w.Action == "review_requested" || w.Action == "review_request_removed" {
+		if w.RequestedReviewer == nil && w.RequestedTeam == nil {
+			return errors.New(`"requested_reviewer" and "requested_team" fields are missing from webhook payload`)
+		}
+	}
+
+	return nil
 }
 
 func (w *PullRequestWebhook) EnhanceLogger(l log.LeveledLogger) log.LeveledLogger {
@@ -40,6 +61,10 @@ func (w *PullRequestWebhook) EnhanceLogger(l log.LeveledLogger) log.LeveledLogge
 		)
 	}
 
+	if w.RequestedTeam != nil {
+		l = l.With("requested_team", w.RequestedTeam.Slug)
+	}
+
 	return l
 }
 
@@ -49,6 +74,7 @@ type PullRequestReviewWebhook struct {
 	Review      *Review      `json:"review"`
 	PullRequest *PullRequest `json:"pull_request"`
 	Repository  *Repository  `json:"repository"`
+	Sender      *User        `json:"sender"`
 }
 
 func (w *PullRequestReviewWebhook) EnhanceLogger(l log.LeveledLogger) log.LeveledLogger {
@@ -77,5 +103,99 @@ func (w *PullRequestReviewWebhook) Validate() error {
 		return errors.New(`"pull_request" field is missing from webhook payload`)
 	}
 
+	if w.Repository == nil {
+		return errors.New(`"repository" field is missing from webhook payload`)
+	}
+
+	return nil
+}
+
+type PullRequestReviewCommentWebhook struct {
+	// Action can be "created", "edited", or "deleted".
+	Action      string       `json:"action"`
+	Comment     *Comment     `json:"comment"`
+	PullRequest *PullRequest `json:"pull_request"`
+	Repository  *Repository  `json:"repository"`
+}
+
+func (w *PullRequestReviewCommentWebhook) EnhanceLogger(l log.LeveledLogger) log.LeveledLogger {
+	l = l.With("action", w.Action)
+
+	if w.Repository != nil {
+		l = l.With("repo.name", w.Repository.Name)
+	}
+
+	if w.PullRequest != nil {
+		l = l.With(
+			"pr.number", w.PullRequest.Number,
+			"pr.url", w.PullRequest.HTMLURL,
+		)
+	}
+
+	if w.Comment != nil {
+		l = l.With("comment.id", w.Comment.ID)
+	}
+
+	return l
+}
+
+func (w *PullRequestReviewCommentWebhook) Validate() error {
+	if w.Comment == nil {
+		return errors.New(`"comment" field is missing from webhook payload`)
+	}
+
+	if w.PullRequest == nil {
+		return errors.New(`"pull_request" field is missing from webhook payload`)
+	}
+
+	if w.Repository == nil {
+		return errors.New(`"repository" field is missing from webhook payload`)
+	}
+
+	return nil
+}
+
+type IssueCommentWebhook struct {
+	// Action can be "created", "edited", or "deleted".
+	Action     string      `json:"action"`
+	Comment    *Comment    `json:"comment"`
+	Issue      *Issue      `json:"issue"`
+	Repository *Repository `json:"repository"`
+}
+
+func (w *IssueCommentWebhook) EnhanceLogger(l log.LeveledLogger) log.LeveledLogger {
+	l = l.With("action", w.Action)
+
+	if w.Repository != nil {
+		l = l.With("repo.name", w.Repository.Name)
+	}
+
+	if w.Issue != nil {
+		l = l.With(
+			"issue.number", w.Issue.Number,
+			"issue.url", w.Issue.HTMLURL,
+		)
+	}
+
+	if w.Comment != nil {
+		l = l.With("comment.id", w.Comment.ID)
+	}
+
+	return l
+}
+
+func (w *IssueCommentWebhook) Validate() error {
+	if w.Comment == nil {
+		return errors.New(`"comment" field is missing from webhook payload`)
+	}
+
+	if w.Issue == nil {
+		return errors.New(`"issue" field is missing from webhook payload`)
+	}
+
+	if w.Repository == nil {
+		return errors.New(`"repository" field is missing from webhook payload`)
+	}
+
 	return nil
 }
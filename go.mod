@@ -8,6 +8,7 @@ require (
 	github.com/joho/godotenv v0.0.0-20170328200154-325433c502d4
 	github.com/julienschmidt/httprouter v1.1.1-0.20170104185816-8a45e95fc75c
 	github.com/slack-go/slack v0.14.0
+	go.etcd.io/bbolt v1.3.10
 )
 
 require (
@@ -20,5 +21,6 @@ require (
 	github.com/juju/loggo v0.0.0-20200526014432-9ce3a2e09b5e // indirect
 	github.com/kardianos/osext v0.0.0-20160811001526-c2c54e542fb7 // indirect
 	github.com/kr/logfmt v0.0.0-20140226030751-b84e30acd515 // indirect
-	github.com/stretchr/testify v1.7.0 // indirect
+	github.com/stretchr/testify v1.8.1 // indirect
+	golang.org/x/sys v0.4.0 // indirect
 )
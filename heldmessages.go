@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/geckoboard/cake-bot/ctx"
+	"github.com/geckoboard/cake-bot/store"
+	slackapi "github.com/slack-go/slack"
+)
+
+// HeldMessage is a direct message held until its recipient is next working.
+type HeldMessage struct {
+	// ID identifies the message in the HeldMessageStore it was listed from.
+	ID string `json:"-"`
+
+	// UserID is the Slack user the message is for.
+	UserID string          `json:"user_id"`
+	Blocks slackapi.Blocks `json:"blocks"`
+	SendAt time.Time       `json:"send_at"`
+}
+
+// HeldMessageStore keeps the direct messages that are held until their
+// recipients are next working.
+type HeldMessageStore interface {
+	Hold(HeldMessage) error
+	// Due returns the messages to send by t, oldest first, with their IDs.
+	Due(t time.Time) ([]HeldMessage, error)
+	Remove(id string) error
+}
+
+// StoreHeldMessageStore is a HeldMessageStore kept in the held messages bucket
+// of a store.Store.
+type StoreHeldMessageStore struct {
+	store store.Store
+
+	// held tells apart the messages held until the same time.
+	held atomic.Int64
+}
+
+func NewStoreHeldMessageStore(s store.Store) *StoreHeldMessageStore {
+	return &StoreHeldMessageStore{store: s}
+}
+
+// errScanDone stops a scan early.
+var errScanDone = errors.New("scan done")
+
+func (s *StoreHeldMessageStore) Hold(msg HeldMessage) error {
+	// Keyed by when they are due, so that the due ones are scanned first.
+	id := fmt.Sprintf("%s|%d|%d",
+		store.TimeKey(msg.SendAt), time.Now().UnixNano(), s.held.Add(1),
+	)
+	return store.PutJSON(s.store, store.HeldMessages, id, msg)
+}
+
+func (s *StoreHeldMessageStore) Due(t time.Time) ([]HeldMessage, error) {
+	var due []HeldMessage
+	err := s.store.Scan(store.HeldMessages, "", func(id string, value []byte) error {
+		var msg HeldMessage
+		if err := json.Unmarshal(value, &msg); err != nil {
+			return err
+		}
+		if msg.SendAt.After(t) {
+			return errScanDone
+		}
+		msg.ID = id
+		due = append(due, msg)
+		return nil
+	})
+	if errors.Is(err, errScanDone) {
+		err = nil
+	}
+	return due, err
+}
+
+func (s *StoreHeldMessageStore) Remove(id string) error {
+	return s.store.Delete(store.HeldMessages, id)
+}
+
+// DirectMessenger sends direct messages on Slack.
+type DirectMessenger interface {
+	DirectMessage(c context.Context, userID string, blocks []slackapi.Block) error
+}
+
+// HeldMessageSender periodically sends the held direct messages that are due.
+type HeldMessageSender struct {
+	store     HeldMessageStore
+	messenger DirectMessenger
+	now       func() time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewHeldMessageSender(store HeldMessageStore, messenger DirectMessenger) *HeldMessageSender {
+	return &HeldMessageSender{
+		store:     store,
+		messenger: messenger,
+		now:       time.Now,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start sends the messages that are due every interval until Stop is called.
+func (s *HeldMessageSender) Start(interval time.Duration) {
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		c := ctx.WithLogger(context.Background(), logger)
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Send(c); err != nil {
+					ctx.Logger(c).Error("at", "held_direct_message_error", "err", err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop waits for the messages being sent, if any, and stops sending them.
+func (s *HeldMessageSender) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+// Send sends every held message that is due. A message that fails is tried
+// again on the next send.
+func (s *HeldMessageSender) Send(c context.Context) error {
+	due, err := s.store.Due(s.now())
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, msg := range due {
+		if err := s.messenger.DirectMessage(c, msg.UserID, msg.Blocks.BlockSet); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := s.store.Remove(msg.ID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/geckoboard/cake-bot/store"
+	slackapi "github.com/slack-go/slack"
+)
+
+// fakeMessenger records the direct messages it is asked to send, failing for
+// the users in failing.
+type fakeMessenger struct {
+	sent    map[string][]slackapi.Block
+	failing map[string]bool
+}
+
+func (f *fakeMessenger) DirectMessage(_ context.Context, userID string, blocks []slackapi.Block) error {
+	if f.failing[userID] {
+		return errors.New("channel_not_found")
+	}
+	if f.sent == nil {
+		f.sent = make(map[string][]slackapi.Block)
+	}
+	f.sent[userID] = blocks
+	return nil
+}
+
+func TestHeldMessageSender(t *testing.T) {
+	held := NewStoreHeldMessageStore(store.NewMemory())
+	messenger := &fakeMessenger{failing: map[string]bool{"U3": true}}
+	sender := NewHeldMessageSender(held, messenger)
+
+	now := time.Date(2024, 1, 3, 9, 0, 0, 0, time.UTC)
+	sender.now = func() time.Time { return now }
+
+	blocks := slackapi.Blocks{BlockSet: []slackapi.Block{buildTextMessageBlock("Review my pull request")}}
+	for _, msg := range []HeldMessage{
+		{UserID: "U1", Blocks: blocks, SendAt: now},
+		{UserID: "U2", Blocks: blocks, SendAt: now.Add(time.Hour)},
+		{UserID: "U3", Blocks: blocks, SendAt: now.Add(-time.Hour)},
+	} {
+		if err := held.Hold(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := sender.Send(context.Background()); err == nil {
+		t.Error("expected the message that couldn't be sent to fail")
+	}
+
+	if len(messenger.sent) != 1 || len(messenger.sent["U1"]) != 1 {
+		t.Fatalf("expected only the message due to be sent, got: %#v", messenger.sent)
+	}
+	if section, ok := messenger.sent["U1"][0].(*slackapi.SectionBlock); !ok || section.Text.Text != "Review my pull request" {
+		t.Errorf("expected the held blocks to be sent, got: %#v", messenger.sent["U1"][0])
+	}
+
+	due, err := held.Due(now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 2 || due[0].UserID != "U3" || due[1].UserID != "U2" {
+		t.Fatalf("expected the failed and the later messages to be kept, oldest first, got: %#v", due)
+	}
+}
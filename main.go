@@ -1,18 +1,38 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	bugsnag "github.com/bugsnag/bugsnag-go"
+	"github.com/geckoboard/cake-bot/ctx"
+	"github.com/geckoboard/cake-bot/github"
 	"github.com/geckoboard/cake-bot/log"
 	"github.com/geckoboard/cake-bot/slack"
+	"github.com/geckoboard/cake-bot/store"
 	"github.com/joho/godotenv"
 	slackapi "github.com/slack-go/slack"
 )
 
+const (
+	// GitHub only redelivers webhooks from the last few days, and in
+	// practice redeliveries happen within minutes of the original.
+	deliveryCacheTTL = 24 * time.Hour
+
+	// Heroku sends SIGKILL 30 seconds after SIGTERM.
+	shutdownTimeout = 25 * time.Second
+
+	reminderCheckInterval    = time.Minute
+	heldMessageCheckInterval = time.Minute
+)
+
 var (
 	logger log.LeveledLogger = log.New()
 )
@@ -22,30 +42,368 @@ func main() {
 		logger.Error("msg", "Error loading .env file")
 	}
 
+	slackToken := mustGetenv("SLACK_TOKEN")
+	slackClient := slack.New(slackToken)
+	githubClient := github.NewClient(os.Getenv("GITHUB_TOKEN"))
+
+	overridesFile := os.Getenv("USER_OVERRIDES_FILE")
+	if overridesFile != "" {
+		overrides, err := LoadUserOverrides(overridesFile)
+		if err != nil {
+			logger.Error("msg", "couldn't load user overrides", "err", err)
+			os.Exit(1)
+		}
+		slack.Users.SetOverrides(overrides.Users)
+	}
+	if getenvBool("MATCH_USERS_BY_EMAIL", false) {
+		slack.Users.MatchByEmail(githubClient, getenvDuration("EMAIL_MATCH_TTL", 24*time.Hour))
+	}
+
+	// whois runs alongside the server, which holds the lock on the store, so
+	// it goes without it.
+	if len(os.Args) > 1 && os.Args[1] == "whois" {
+		refreshSlackUsers(slackClient)
+		whois(os.Args[2:])
+		return
+	}
+
 	var (
 		httpPort     = mustGetenv("PORT")
 		githubSecret = mustGetenv("GITHUB_SECRET")
-		slackToken   = mustGetenv("SLACK_TOKEN")
+
+		slackSigningSecret = mustGetenv("SLACK_SIGNING_SECRET")
 	)
 
-	slackClient := slack.New(slackToken)
+	db := mustOpenStore()
+	defer db.Close()
+
+	if err := slack.Users.Restore(db); err != nil {
+		logger.Error("msg", "couldn't restore Slack users", "err", err)
+	}
+
+	heldMessages := NewStoreHeldMessageStore(db)
+	slackNotifier, router := newSlackNotifier(slackToken, NewStoreMessageStore(db), heldMessages)
+
+	if overridesFile != "" {
+		go reloadUserOverridesOnSignal(overridesFile)
+	}
 
+	usersLoaded := make(chan struct{})
 	go func() {
 		refreshSlackUsers(slackClient)
+		reportUnknownOverrides()
+		close(usersLoaded)
 		for range time.Tick(5 * time.Minute) {
 			refreshSlackUsers(slackClient)
 		}
 	}()
 
-	notifier := NewSlackNotifier(slackapi.New(slackToken))
-	webhookValidator := NewGitHubWebhookValidator(githubSecret)
+	pendingReviews := NewStoreReminderStore(db)
+	statsStore := NewStoreStatsStore(db)
+	deadLetters := NewStoreDeadLetterLog(db)
+	deliveries, err := NewStoreDeliveryCache(db, deliveryCacheTTL)
+	if err != nil {
+		logger.Error("msg", "couldn't expire deliveries", "err", err)
+		os.Exit(1)
+	}
+
+	reminders := NewReminderScheduler(pendingReviews, slackNotifier, ReminderPolicy{
+		RemindAfter:   getenvDuration("REVIEW_REMIND_AFTER", DefaultReminderPolicy.RemindAfter),
+		EscalateAfter: getenvDuration("REVIEW_ESCALATE_AFTER", DefaultReminderPolicy.EscalateAfter),
+	})
+	reminders.Start(reminderCheckInterval)
+
+	held := NewHeldMessageSender(heldMessages, slackNotifier)
+	held.Start(heldMessageCheckInterval)
+
+	background := []stopper{reminders, held}
+	if at := os.Getenv("DIGEST_TIME"); at != "" {
+		digest := NewDigest(pendingReviews, router, slackNotifier, splitList(os.Getenv("DIGEST_USERS")))
+		background = append(background, mustStartScheduledJob("DIGEST", at, Weekdays, digest.Send))
+	}
+
+	stats := NewStats(statsStore, pendingReviews)
+	if at := os.Getenv("LEADERBOARD_TIME"); at != "" {
+		channels := router.Default
+		if list := os.Getenv("LEADERBOARD_CHANNELS"); list != "" {
+			channels = splitList(list)
+		}
+		background = append(background, mustStartScheduledJob("LEADERBOARD", at, []time.Weekday{time.Monday}, func(c context.Context) error {
+			return stats.PostLeaderboard(c, slackNotifier, channels)
+		}))
+	}
+
+	notifierWith := func(deadLetters DeadLetterLog) Notifier {
+		return NewStatsRecorder(
+			NewReminderTracker(NewRetryingNotifier(slackNotifier, DefaultRetryPolicy, deadLetters), pendingReviews),
+			pendingReviews, statsStore,
+		)
+	}
+	notifier := notifierWith(deadLetters)
+
+	// Replayed notifications that fail again are kept by the replay, so they
+	// aren't dead-lettered twice.
+	go replayDeadLettersOnSignal(usersLoaded, deadLetters, notifierWith(nil))
+	webhookValidator := NewGitHubWebhookValidator(splitList(githubSecret), getenvBool("GITHUB_ALLOW_SHA1", true))
+	slackValidator := NewSlackRequestValidator(slackSigningSecret, DefaultSlackRequestMaxAge)
+	queue := NewEventQueue(getenvInt("QUEUE_CONCURRENCY", 4), getenvInt("QUEUE_CAPACITY", 1000))
+	queue.Start()
+	comments := NewCommentBatcher(getenvDuration("COMMENT_BATCH_DELAY", 15*time.Second))
+
+	drafts, err := ParseDraftPolicy(getenv("DRAFT_REVIEW_REQUESTS", string(DraftDefer)))
+	if err != nil {
+		logger.Error("msg", "invalid DRAFT_REVIEW_REQUESTS", "err", err)
+		os.Exit(1)
+	}
+
+	serverOpts := []ServerOption{
+		WithDeliveryCache(deliveries),
+		WithEventQueue(queue),
+		WithCommentBatcher(comments),
+		WithDraftPolicy(drafts),
+		WithStats(stats, os.Getenv("STATS_TOKEN")),
+		WithSlashCommands(NewSlashCommands(pendingReviews, stats, slackNotifier)),
+	}
+
+	assign, err := ParseAssignMode(getenv("AUTO_ASSIGN_REVIEWERS", string(AssignOff)))
+	if err != nil {
+		logger.Error("msg", "invalid AUTO_ASSIGN_REVIEWERS", "err", err)
+		os.Exit(1)
+	}
+
+	pools := mustLoadReviewerPools()
+	if pools != nil {
+		serverOpts = append(serverOpts, WithReassigner(NewReassigner(githubClient, pools, slackNotifier)))
+	}
+	if assign != AssignOff {
+		if pools == nil {
+			logger.Error("msg", "AUTO_ASSIGN_REVIEWERS needs REVIEWER_POOLS_FILE to be set")
+			os.Exit(1)
+		}
+		serverOpts = append(serverOpts, WithAssigner(NewAssigner(githubClient, pools, pendingReviews, slackNotifier, assign)))
+	}
+
+	server := NewServer(notifier, webhookValidator, slackValidator, serverOpts...)
 	httpServer := http.Server{
 		Addr:    ":" + httpPort,
-		Handler: bugsnag.Handler(NewServer(notifier, webhookValidator)),
+		Handler: bugsnag.Handler(server),
 	}
 
+	go shutdownOnSignal(&httpServer, comments, queue, background...)
+
 	logger.Info("msg", fmt.Sprintf("Listening on port %s", httpPort))
-	_ = httpServer.ListenAndServe()
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		logger.Error("msg", "HTTP server stopped", "err", err)
+		os.Exit(1)
+	}
+
+	<-shutdownComplete
+}
+
+var shutdownComplete = make(chan struct{})
+
+// stopper is a background task that can be stopped on shutdown.
+type stopper interface {
+	Stop()
+}
+
+// shutdownOnSignal stops accepting webhooks on SIGTERM/SIGINT and gives the
+// event queue a chance to deliver the events it has already accepted.
+func shutdownOnSignal(httpServer *http.Server, comments *CommentBatcher, queue *EventQueue, background ...stopper) {
+	defer close(shutdownComplete)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	<-signals
+
+	logger.Info("msg", "Shutting down")
+
+	for _, task := range background {
+		task.Stop()
+	}
+
+	c, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := httpServer.Shutdown(c); err != nil {
+		logger.Error("msg", "couldn't shut down HTTP server", "err", err)
+	}
+
+	comments.Flush()
+
+	if err := queue.Drain(c); err != nil {
+		logger.Error("msg", "couldn't drain event queue", "err", err)
+	}
+}
+
+// newSlackNotifier configures the Slack notifier and the channels it routes
+// notifications to from the environment.
+func newSlackNotifier(slackToken string, messages MessageStore, held HeldMessageStore) (*SlackNotifier, *ChannelRouter) {
+	opts := []SlackNotifierOption{
+		WithMessageStore(messages),
+		WithHeldMessages(held),
+		WithThreads(getenvBool("SLACK_THREAD_BROADCAST", false)),
+	}
+	if getenvBool("SLACK_CELEBRATE_MERGES", false) {
+		opts = append(opts, WithMergeCelebration())
+	}
+	if getenvBool("SLACK_CHANGES_REQUESTED_DM", false) {
+		opts = append(opts, WithChangesRequestedDM())
+	}
+	if hours := mustLoadWorkingHours(); hours != nil {
+		opts = append(opts, WithWorkingHours(hours))
+	}
+	router := mustLoadChannelRouter()
+	return NewSlackNotifier(slackapi.New(slackToken), router, opts...), router
+}
+
+// replayDeadLettersOnSignal re-sends the notifications that previously ran
+// out of delivery attempts once the Slack users have been loaded, and again on
+// SIGUSR1.
+func replayDeadLettersOnSignal(usersLoaded <-chan struct{}, deadLetters DeadLetterLog, notifier Notifier) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+
+	<-usersLoaded
+	for {
+		replayed, err := ReplayDeadLetters(ctx.WithLogger(context.Background(), logger), deadLetters, notifier)
+		if err != nil {
+			logger.Error("msg", "couldn't replay dead letters", "err", err)
+		} else if replayed > 0 {
+			logger.Info("msg", fmt.Sprintf("Replayed %d dead letters", replayed))
+		}
+		<-signals
+	}
+}
+
+// mustOpenStore opens the database at STORE_FILE, migrating it to the latest
+// schema.
+func mustOpenStore() store.Store {
+	db, err := store.OpenBolt(getenv("STORE_FILE", "cake-bot.db"))
+	if err != nil {
+		logger.Error("msg", "couldn't open store", "err", err)
+		os.Exit(1)
+	}
+	return db
+}
+
+// whois prints the Slack user of each GitHub login, and how they were matched.
+// Run it with `cake-bot whois <login>...`.
+func whois(logins []string) {
+	for _, login := range logins {
+		c, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		match := slack.Users.AwaitMatch(c, login)
+		cancel()
+		switch {
+		case match == nil:
+			fmt.Printf("%s: not found on Slack\n", login)
+		case match.Source == slack.MatchedByEmail:
+			fmt.Printf("%s: %s (%s), matched by email %s\n", login, match.User.Name, match.User.ID, match.Email)
+		default:
+			fmt.Printf("%s: %s (%s), matched by %s\n", login, match.User.Name, match.User.ID, match.Source)
+		}
+	}
+	for _, login := range slack.Users.UnknownOverrides() {
+		fmt.Printf("%s: overridden with an unknown Slack user\n", login)
+	}
+}
+
+// mustLoadChannelRouter loads the routing table from SLACK_ROUTES_FILE, or
+// routes everything to SLACK_NOTIFICATION_CHANNEL if there isn't one.
+func mustLoadChannelRouter() *ChannelRouter {
+	filename := os.Getenv("SLACK_ROUTES_FILE")
+	if filename == "" {
+		return NewChannelRouter(getenv("SLACK_NOTIFICATION_CHANNEL", "#devs"))
+	}
+
+	router, err := LoadChannelRouter(filename)
+	if err != nil {
+		logger.Error("msg", "couldn't load Slack routes", "err", err)
+		os.Exit(1)
+	}
+	return router
+}
+
+// mustStartScheduledJob starts running a job at <name>_TIME on days, in the
+// <name>_TIMEZONE timezone which defaults to UTC.
+func mustStartScheduledJob(name, at string, days []time.Weekday, run func(context.Context) error) *ScheduledJob {
+	loc, err := time.LoadLocation(getenv(name+"_TIMEZONE", "UTC"))
+	if err != nil {
+		logger.Error("msg", fmt.Sprintf("Invalid timezone environment variable: %s_TIMEZONE", name), "err", err)
+		os.Exit(1)
+	}
+
+	job, err := NewScheduledJob(at, loc, days, run)
+	if err != nil {
+		logger.Error("msg", fmt.Sprintf("Invalid time environment variable: %s_TIME", name), "err", err)
+		os.Exit(1)
+	}
+
+	job.Start()
+	return job
+}
+
+// mustLoadReviewerPools loads the reviewer pools from REVIEWER_POOLS_FILE, or
+// returns nil if there isn't one. Changing reviewers needs a GITHUB_TOKEN.
+func mustLoadReviewerPools() *ReviewerPools {
+	filename := os.Getenv("REVIEWER_POOLS_FILE")
+	if filename == "" {
+		return nil
+	}
+
+	if os.Getenv("GITHUB_TOKEN") == "" {
+		logger.Error("msg", "REVIEWER_POOLS_FILE needs GITHUB_TOKEN to be set")
+		os.Exit(1)
+	}
+
+	pools, err := LoadReviewerPools(filename)
+	if err != nil {
+		logger.Error("msg", "couldn't load reviewer pools", "err", err)
+		os.Exit(1)
+	}
+	return pools
+}
+
+// mustLoadWorkingHours loads the working hours from WORKING_HOURS_FILE, or
+// returns nil if there isn't one.
+func mustLoadWorkingHours() *WorkingHoursConfig {
+	filename := os.Getenv("WORKING_HOURS_FILE")
+	if filename == "" {
+		return nil
+	}
+
+	hours, err := LoadWorkingHours(filename)
+	if err != nil {
+		logger.Error("msg", "couldn't load working hours", "err", err)
+		os.Exit(1)
+	}
+	return hours
+}
+
+// reloadUserOverridesOnSignal reloads the user overrides from filename on
+// SIGHUP, keeping the current ones if the file is invalid.
+func reloadUserOverridesOnSignal(filename string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		overrides, err := LoadUserOverrides(filename)
+		if err != nil {
+			logger.Error("msg", "couldn't reload user overrides", "err", err)
+			continue
+		}
+		slack.Users.SetOverrides(overrides.Users)
+		logger.Info("msg", fmt.Sprintf("Reloaded %d user overrides", len(overrides.Users)))
+		reportUnknownOverrides()
+	}
+}
+
+// reportUnknownOverrides logs the user overrides whose Slack user can't be
+// found.
+func reportUnknownOverrides() {
+	for _, login := range slack.Users.UnknownOverrides() {
+		logger.Error("msg", "unknown Slack user in user overrides", "github", login)
+	}
 }
 
 func refreshSlackUsers(slackClient *slack.Client) {
@@ -63,6 +421,67 @@ func mustGetenv(key string) string {
 	return str
 }
 
+// splitList splits a comma separated environment variable into its non-empty
+// values.
+func splitList(str string) []string {
+	var values []string
+	for _, v := range strings.Split(str, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func getenv(key, fallback string) string {
+	if str := os.Getenv(key); str != "" {
+		return str
+	}
+	return fallback
+}
+
+func getenvBool(key string, fallback bool) bool {
+	str := os.Getenv(key)
+	if str == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(str)
+	if err != nil {
+		logger.Error("msg", fmt.Sprintf("Invalid boolean environment variable: %s", key))
+		os.Exit(1)
+	}
+	return b
+}
+
+func getenvInt(key string, fallback int) int {
+	str := os.Getenv(key)
+	if str == "" {
+		return fallback
+	}
+
+	i, err := strconv.Atoi(str)
+	if err != nil || i <= 0 {
+		logger.Error("msg", fmt.Sprintf("Invalid integer environment variable: %s", key))
+		os.Exit(1)
+	}
+	return i
+}
+
+func getenvDuration(key string, fallback time.Duration) time.Duration {
+	str := os.Getenv(key)
+	if str == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(str)
+	if err != nil {
+		logger.Error("msg", fmt.Sprintf("Invalid duration environment variable: %s", key))
+		os.Exit(1)
+	}
+	return d
+}
+
 func init() {
 	bugsnag.Configure(bugsnag.Configuration{
 		APIKey: os.Getenv("BUGSNAG_API_KEY"),
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/geckoboard/cake-bot/github"
+	"github.com/geckoboard/cake-bot/store"
+)
+
+// MessageRef identifies a Slack message that cake-bot has posted.
+type MessageRef struct {
+	Channel   string `json:"channel"`
+	Timestamp string `json:"ts"`
+}
+
+// PullRequestKey identifies a pull request across repositories.
+type PullRequestKey struct {
+	Repo   string `json:"repo"`
+	Number int    `json:"number"`
+}
+
+func (k PullRequestKey) String() string {
+	return fmt.Sprintf("%s#%d", k.Repo, k.Number)
+}
+
+// ParsePullRequestKey parses the String form of a PullRequestKey.
+func ParsePullRequestKey(s string) (PullRequestKey, error) {
+	i := strings.LastIndex(s, "#")
+	if i <= 0 {
+		return PullRequestKey{}, fmt.Errorf("invalid pull request %q", s)
+	}
+
+	number, err := strconv.Atoi(s[i+1:])
+	if err != nil {
+		return PullRequestKey{}, fmt.Errorf("invalid pull request %q: %w", s, err)
+	}
+	return PullRequestKey{Repo: s[:i], Number: number}, nil
+}
+
+// ReviewRequestMessage is a message asking someone to review a pull request.
+type ReviewRequestMessage struct {
+	// Reviewer is the GitHub login of the reviewer, or the slug of the team
+	// prefixed with "@" for team review requests.
+	Reviewer string     `json:"reviewer"`
+	Text     string     `json:"text"`
+	Ref      MessageRef `json:"ref"`
+}
+
+// CakeMessage is a message telling the author that their pull request has
+// been approved.
+type CakeMessage struct {
+	// Giver is the GitHub login of the approving reviewer.
+	Giver    string     `json:"giver"`
+	ReviewID int        `json:"review_id"`
+	Text     string     `json:"text"`
+	Ref      MessageRef `json:"ref"`
+}
+
+// MessageStore remembers the Slack messages cake-bot has posted about pull
+// requests, so that they can be replied to or updated later.
+type MessageStore interface {
+	// Thread returns the first message posted about the pull request in
+	// channel, or nil if there isn't one.
+	Thread(channel string, pr PullRequestKey) (*MessageRef, error)
+	SetThread(channel string, pr PullRequestKey, ref MessageRef) error
+
+	ReviewRequestMessages(pr PullRequestKey) ([]ReviewRequestMessage, error)
+	AddReviewRequestMessage(pr PullRequestKey, msg ReviewRequestMessage) error
+	RemoveReviewRequestMessages(pr PullRequestKey, reviewer string) error
+
+	CakeMessages(pr PullRequestKey) ([]CakeMessage, error)
+	AddCakeMessage(pr PullRequestKey, msg CakeMessage) error
+	RemoveCakeMessages(pr PullRequestKey, reviewID int) error
+
+	// Review returns the last known state of a review of the pull request,
+	// or nil if it isn't known.
+	Review(pr PullRequestKey, id int) (*github.Review, error)
+	SetReview(pr PullRequestKey, review *github.Review) error
+
+	// DeletePullRequest forgets every message posted about the pull request.
+	DeletePullRequest(pr PullRequestKey) error
+}
+
+// pullRequestMessages is the document a StoreMessageStore keeps for each pull
+// request.
+type pullRequestMessages struct {
+	Threads        map[string]MessageRef  `json:"threads,omitempty"`
+	ReviewRequests []ReviewRequestMessage `json:"review_requests,omitempty"`
+	Cakes          []CakeMessage          `json:"cakes,omitempty"`
+	Reviews        map[int]github.Review  `json:"reviews,omitempty"`
+}
+
+// StoreMessageStore is a MessageStore kept in the pull requests bucket of a
+// store.Store, with one document per pull request.
+type StoreMessageStore struct {
+	store store.Store
+}
+
+func NewStoreMessageStore(s store.Store) *StoreMessageStore {
+	return &StoreMessageStore{store: s}
+}
+
+func (s *StoreMessageStore) get(pr PullRequestKey) (*pullRequestMessages, error) {
+	var msgs pullRequestMessages
+	_, err := store.GetJSON(s.store, store.PullRequests, pr.String(), &msgs)
+	return &msgs, err
+}
+
+func (s *StoreMessageStore) update(pr PullRequestKey, fn func(*pullRequestMessages)) error {
+	var msgs pullRequestMessages
+	return store.UpdateJSON(s.store, store.PullRequests, pr.String(), &msgs, func(bool) (bool, error) {
+		fn(&msgs)
+		return true, nil
+	})
+}
+
+func (s *StoreMessageStore) Thread(channel string, pr PullRequestKey) (*MessageRef, error) {
+	msgs, err := s.get(pr)
+	if err != nil {
+		return nil, err
+	}
+
+	if ref, ok := msgs.Threads[channel]; ok {
+		return &ref, nil
+	}
+	return nil, nil
+}
+
+func (s *StoreMessageStore) SetThread(channel string, pr PullRequestKey, ref MessageRef) error {
+	return s.update(pr, func(msgs *pullRequestMessages) {
+		if msgs.Threads == nil {
+			msgs.Threads = make(map[string]MessageRef)
+		}
+		msgs.Threads[channel] = ref
+	})
+}
+
+func (s *StoreMessageStore) ReviewRequestMessages(pr PullRequestKey) ([]ReviewRequestMessage, error) {
+	msgs, err := s.get(pr)
+	if err != nil {
+		return nil, err
+	}
+	return msgs.ReviewRequests, nil
+}
+
+func (s *StoreMessageStore) AddReviewRequestMessage(pr PullRequestKey, msg ReviewRequestMessage) error {
+	return s.update(pr, func(msgs *pullRequestMessages) {
+		msgs.ReviewRequests = append(msgs.ReviewRequests, msg)
+	})
+}
+
+func (s *StoreMessageStore) RemoveReviewRequestMessages(pr PullRequestKey, reviewer string) error {
+	return s.update(pr, func(msgs *pullRequestMessages) {
+		var kept []ReviewRequestMessage
+		for _, msg := range msgs.ReviewRequests {
+			if !strings.EqualFold(msg.Reviewer, reviewer) {
+				kept = append(kept, msg)
+			}
+		}
+		msgs.ReviewRequests = kept
+	})
+}
+
+func (s *StoreMessageStore) CakeMessages(pr PullRequestKey) ([]CakeMessage, error) {
+	msgs, err := s.get(pr)
+	if err != nil {
+		return nil, err
+	}
+	return msgs.Cakes, nil
+}
+
+func (s *StoreMessageStore) AddCakeMessage(pr PullRequestKey, msg CakeMessage) error {
+	return s.update(pr, func(msgs *pullRequestMessages) {
+		msgs.Cakes = append(msgs.Cakes, msg)
+	})
+}
+
+func (s *StoreMessageStore) RemoveCakeMessages(pr PullRequestKey, reviewID int) error {
+	return s.update(pr, func(msgs *pullRequestMessages) {
+		var kept []CakeMessage
+		for _, msg := range msgs.Cakes {
+			if msg.ReviewID != reviewID {
+				kept = append(kept, msg)
+			}
+		}
+		msgs.Cakes = kept
+	})
+}
+
+func (s *StoreMessageStore) Review(pr PullRequestKey, id int) (*github.Review, error) {
+	msgs, err := s.get(pr)
+	if err != nil {
+		return nil, err
+	}
+
+	if review, ok := msgs.Reviews[id]; ok {
+		return &review, nil
+	}
+	return nil, nil
+}
+
+func (s *StoreMessageStore) SetReview(pr PullRequestKey, review *github.Review) error {
+	return s.update(pr, func(msgs *pullRequestMessages) {
+		if msgs.Reviews == nil {
+			msgs.Reviews = make(map[int]github.Review)
+		}
+		msgs.Reviews[review.ID] = *review
+	})
+}
+
+func (s *StoreMessageStore) DeletePullRequest(pr PullRequestKey) error {
+	return s.store.Delete(store.PullRequests, pr.String())
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/geckoboard/cake-bot/github"
+	"github.com/geckoboard/cake-bot/store"
+)
+
+func TestStoreMessageStore(t *testing.T) {
+	s := NewStoreMessageStore(store.NewMemory())
+	pr := PullRequestKey{Repo: "geckoboard/cake-bot", Number: 12}
+	other := PullRequestKey{Repo: "geckoboard/cake-bot", Number: 13}
+
+	if ref, err := s.Thread("#devs", pr); err != nil || ref != nil {
+		t.Fatalf("expected no thread yet, got: %v, %v", ref, err)
+	}
+	_ = s.SetThread("#devs", pr, MessageRef{Channel: "C1", Timestamp: "1.1"})
+	if ref, _ := s.Thread("#devs", pr); ref == nil || ref.Timestamp != "1.1" {
+		t.Fatalf("expected the thread to be remembered, got: %v", ref)
+	}
+	if ref, _ := s.Thread("#reviews", pr); ref != nil {
+		t.Fatalf("expected threads to be kept per channel, got: %v", ref)
+	}
+
+	_ = s.AddReviewRequestMessage(pr, ReviewRequestMessage{Reviewer: "alice", Text: "a"})
+	_ = s.AddReviewRequestMessage(pr, ReviewRequestMessage{Reviewer: "bob", Text: "b"})
+	_ = s.RemoveReviewRequestMessages(pr, "Alice")
+	if msgs, _ := s.ReviewRequestMessages(pr); len(msgs) != 1 || msgs[0].Reviewer != "bob" {
+		t.Fatalf("expected only bob's review request to be left, got: %#v", msgs)
+	}
+
+	_ = s.AddCakeMessage(pr, CakeMessage{Giver: "alice", ReviewID: 1})
+	_ = s.AddCakeMessage(pr, CakeMessage{Giver: "bob", ReviewID: 2})
+	_ = s.RemoveCakeMessages(pr, 1)
+	if msgs, _ := s.CakeMessages(pr); len(msgs) != 1 || msgs[0].ReviewID != 2 {
+		t.Fatalf("expected only the second cake to be left, got: %#v", msgs)
+	}
+
+	_ = s.SetReview(pr, &github.Review{ID: 2, State: "approved"})
+	if review, _ := s.Review(pr, 2); review == nil || review.State != "approved" {
+		t.Fatalf("expected the review to be remembered, got: %#v", review)
+	}
+
+	_ = s.SetThread("#devs", other, MessageRef{Channel: "C1", Timestamp: "2.2"})
+	if err := s.DeletePullRequest(pr); err != nil {
+		t.Fatal(err)
+	}
+	if ref, _ := s.Thread("#devs", pr); ref != nil {
+		t.Errorf("expected the thread to be forgotten, got: %v", ref)
+	}
+	if review, _ := s.Review(pr, 2); review != nil {
+		t.Errorf("expected the review to be forgotten, got: %#v", review)
+	}
+	if ref, _ := s.Thread("#devs", other); ref == nil {
+		t.Error("expected other pull requests to be left alone")
+	}
+}
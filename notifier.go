@@ -2,10 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/geckoboard/cake-bot/ctx"
 	"github.com/geckoboard/cake-bot/github"
 	"github.com/geckoboard/cake-bot/slack"
 	slackapi "github.com/slack-go/slack"
@@ -13,32 +17,134 @@ import (
 
 type Notifier interface {
 	ReviewRequested(context.Context, *github.Repository, *github.PullRequest, *github.User) error
+	TeamReviewRequested(context.Context, *github.Repository, *github.PullRequest, *github.Team) error
 	Approved(context.Context, *github.Repository, *github.PullRequest, *github.Review) error
 	ChangesRequested(context.Context, *github.Repository, *github.PullRequest, *github.Review) error
+	Commented(context.Context, *github.Repository, *github.PullRequest, *github.Review) error
+	ReviewEdited(context.Context, *github.Repository, *github.PullRequest, *github.Review) error
+	// ReviewDismissed is called with the user that dismissed the review.
+	ReviewDismissed(context.Context, *github.Repository, *github.PullRequest, *github.Review, *github.User) error
+	// ReviewRequestRemoved is called with the reviewer that is no longer
+	// requested, and the user that withdrew the request. Teams are given as
+	// a reviewer whose login is "@" and the team's slug.
+	ReviewRequestRemoved(context.Context, *github.Repository, *github.PullRequest, *github.User, *github.User) error
+	// Merged and Closed are called with the user that merged or closed the
+	// pull request.
+	Merged(context.Context, *github.Repository, *github.PullRequest, *github.User) error
+	Closed(context.Context, *github.Repository, *github.PullRequest, *github.User) error
+	// CommentsPosted is called with one or more comments made by the same
+	// user, e.g. all the comments of a review.
+	CommentsPosted(context.Context, *github.Repository, *github.PullRequest, []*github.Comment) error
 	RespondToSlackAction(context.Context, *slackapi.InteractionCallback, string) error
 }
 
 const (
 	maxTitleLength            = 80
+	maxSnippetLength          = 200
+	maxDiffHunkLines          = 4
+	maxCommentsPerMessage     = 10
+	maxDigestReviewers        = 40
+	maxDigestReviewsPerUser   = 10
 	reviewingRequestStatusMsg = "reviewing"
 	unableToReviewStatusMsg   = "unable"
-)
-
-var (
-	notificationChannel string
+	reviewerResponseBlockID   = "reviewer_response"
+	reassignStatusMsg         = "reassign"
+	reassignBlockID           = "reassign"
 )
 
 type SlackNotifier struct {
 	client *slackapi.Client
+	router *ChannelRouter
+
+	messages         MessageStore
+	threads          bool
+	broadcastReplies bool
+	celebrateMerges  bool
+	changesDM        bool
+	hours            *WorkingHoursConfig
+
+	// snoozes is when each user, by lower case GitHub login, stops
+	// snoozing.
+	snoozes   map[string]time.Time
+	snoozesMu sync.Mutex
+
+	// held keeps the direct messages held until their recipients are next
+	// working.
+	held HeldMessageStore
+
+	now func() time.Time
+}
+
+// ErrReviewerOffline is returned when a reminder can't be sent because the
+// reviewer is outside their working hours or snoozing.
+var ErrReviewerOffline = errors.New("reviewer is outside their working hours or snoozing")
+
+// SlackNotifierOption configures optional behaviour of the SlackNotifier.
+type SlackNotifierOption func(*SlackNotifier)
+
+// WithMessageStore makes the SlackNotifier remember the messages it posts, so
+// that it can update them when a review request is withdrawn.
+func WithMessageStore(store MessageStore) SlackNotifierOption {
+	return func(n *SlackNotifier) {
+		n.messages = store
+	}
+}
+
+// WithThreads makes the SlackNotifier post approvals and feedback as replies
+// to the first message it posted about the pull request. If broadcast is true
+// the replies are also sent to the channel. It requires a MessageStore.
+func WithThreads(broadcast bool) SlackNotifierOption {
+	return func(n *SlackNotifier) {
+		n.threads = true
+		n.broadcastReplies = broadcast
+	}
 }
 
-func NewSlackNotifier(client *slackapi.Client) *SlackNotifier {
-	targetChannel, ok := os.LookupEnv("SLACK_NOTIFICATION_CHANNEL")
-	if !ok {
-		notificationChannel = "#devs"
+// WithMergeCelebration makes the SlackNotifier post a summary of who gave cake
+// when a pull request is merged, even if there is no thread to reply to.
+func WithMergeCelebration() SlackNotifierOption {
+	return func(n *SlackNotifier) {
+		n.celebrateMerges = true
+	}
+}
+
+// WithChangesRequestedDM makes the SlackNotifier also send the author of a
+// pull request a direct message when changes are requested.
+func WithChangesRequestedDM() SlackNotifierOption {
+	return func(n *SlackNotifier) {
+		n.changesDM = true
+	}
+}
+
+// WithWorkingHours makes the SlackNotifier hold direct messages until the
+// recipient's working hours, and mention in the channel when a reviewer is
+// outside theirs.
+func WithWorkingHours(config *WorkingHoursConfig) SlackNotifierOption {
+	return func(n *SlackNotifier) {
+		n.hours = config
+	}
+}
+
+// WithHeldMessages makes the SlackNotifier keep the direct messages it holds
+// outside working hours or while the recipient is snoozing in store, for a
+// HeldMessageSender to send. Without it they are sent straight away.
+func WithHeldMessages(store HeldMessageStore) SlackNotifierOption {
+	return func(n *SlackNotifier) {
+		n.held = store
+	}
+}
+
+func NewSlackNotifier(client *slackapi.Client, router *ChannelRouter, opts ...SlackNotifierOption) *SlackNotifier {
+	n := &SlackNotifier{
+		client:  client,
+		router:  router,
+		snoozes: make(map[string]time.Time),
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(n)
 	}
-	notificationChannel = targetChannel
-	return &SlackNotifier{client}
+	return n
 }
 
 func (n *SlackNotifier) Approved(c context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review) error {
@@ -49,50 +155,622 @@ func (n *SlackNotifier) Approved(c context.Context, repo *github.Repository, pr
 	)
 
 	messageBlocks := []slackapi.Block{buildTextMessageBlock(text)}
-	return n.notifyChannel(c, notificationChannel, messageBlocks)
+	refs, err := n.notifyThreads(c, repo, pr, messageBlocks)
+
+	n.rememberReview(c, repo, pr, review)
+	if n.messages != nil {
+		for _, ref := range refs {
+			msg := CakeMessage{Giver: review.User.Login, ReviewID: review.ID, Text: text, Ref: ref}
+			if err := n.messages.AddCakeMessage(pullRequestKey(repo, pr), msg); err != nil {
+				ctx.Logger(c).Error("at", "message_store_error", "err", err)
+			}
+		}
+	}
+	return err
 }
 
+// ChangesRequested tells the author that the pull request is blocked until
+// they address the review. Replies about it are always sent to the channel as
+// well as the thread, and the author may also get a direct message.
 func (n *SlackNotifier) ChangesRequested(c context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review) error {
 	text := fmt.Sprintf(
-		"%s you have received some feedback on %s",
-		buildLinkToUser(pr.User),
+		":no_entry: %s changes have been requested by %s on %s",
+		buildLinkToUser(pr.User), buildUserName(review.User),
+		prLink(review.HTMLURL(), repo, pr),
+	)
+
+	messageBlocks := reviewBlocks(text, review)
+	_, err := n.notifyThreadsWith(c, repo, pr, messageBlocks, true)
+
+	n.rememberReview(c, repo, pr, review)
+
+	if n.changesDM {
+		// As with the presence DM, a retry would post to the channel again.
+		if err := n.notifyUser(c, pr.User, messageBlocks); err != nil {
+			ctx.Logger(c).Error("at", "notify_author_error", "err", err)
+		}
+	}
+	return err
+}
+
+// Commented tells the author about a review that neither approves nor blocks
+// the pull request.
+func (n *SlackNotifier) Commented(c context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review) error {
+	text := fmt.Sprintf(
+		":speech_balloon: %s %s has left a review on %s",
+		buildLinkToUser(pr.User), buildUserName(review.User),
 		prLink(review.HTMLURL(), repo, pr),
 	)
 
+	_, err := n.notifyThreads(c, repo, pr, reviewBlocks(text, review))
+
+	n.rememberReview(c, repo, pr, review)
+	return err
+}
+
+// ReviewEdited only records the new state of the review, as the messages
+// posted about it don't include anything that can be edited.
+func (n *SlackNotifier) ReviewEdited(c context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review) error {
+	if n.messages == nil {
+		return nil
+	}
+	return n.messages.SetReview(pullRequestKey(repo, pr), review)
+}
+
+// ReviewDismissed strikes through the cake given by the review if it was an
+// approval, and lets the author know that the review no longer counts.
+func (n *SlackNotifier) ReviewDismissed(c context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review, dismissedBy *github.User) error {
+	key := pullRequestKey(repo, pr)
+
+	var (
+		errs  []error
+		cakes []CakeMessage
+		kind  = "review"
+	)
+
+	if n.messages != nil {
+		all, err := n.messages.CakeMessages(key)
+		if err != nil {
+			return err
+		}
+		for _, cake := range all {
+			if cake.ReviewID == review.ID {
+				cakes = append(cakes, cake)
+			}
+		}
+
+		if previous, err := n.messages.Review(key, review.ID); err == nil && previous != nil && previous.IsApproved() {
+			kind = "approval"
+		}
+	}
+
+	if len(cakes) > 0 {
+		kind = "approval"
+	}
+
+	response := fmt.Sprintf("Approval dismissed by %s", buildUserName(dismissedBy))
+	for _, cake := range cakes {
+		blocks := []slackapi.Block{buildTextMessageBlock(fmt.Sprintf("~%s~", cake.Text))}
+		if err := n.updateMessage(c, cake.Ref, rewriteBlocks(blocks, response)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	text := fmt.Sprintf(
+		"%s the %s from %s on %s was dismissed by %s",
+		buildLinkToUser(pr.User), kind, buildUserName(review.User),
+		prLink(review.HTMLURL(), repo, pr), buildUserName(dismissedBy),
+	)
+
 	messageBlocks := []slackapi.Block{buildTextMessageBlock(text)}
-	return n.notifyChannel(c, notificationChannel, messageBlocks)
+	if _, err := n.notifyThreads(c, repo, pr, messageBlocks); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	if n.messages == nil {
+		return nil
+	}
+
+	if err := n.messages.RemoveCakeMessages(key, review.ID); err != nil {
+		return err
+	}
+	return n.messages.SetReview(key, review)
 }
 
 func (n *SlackNotifier) ReviewRequested(c context.Context, repo *github.Repository, pr *github.PullRequest, reviewer *github.User) error {
+	text := reviewRequestedText(repo, pr, reviewer)
+	messageBlocks := reviewRequestBlocks(text, pullRequestKey(repo, pr), reviewer.Login)
+	if note := n.offlineNote(reviewer); note != nil {
+		// Keep the buttons last.
+		messageBlocks = slices.Insert(messageBlocks, 1, note)
+	}
+
+	// Every reviewer gets their own top-level message so that they can see
+	// the buttons, but the first one starts the thread for the pull request.
+	var errs []error
+	sent := 0
+	for _, channel := range n.router.Channels(repo, pr) {
+		ref, err := n.notifyChannel(c, channel, messageBlocks)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sent++
+		n.rememberThread(c, channel, repo, pr, ref)
+		n.rememberReviewRequest(c, repo, pr, ReviewRequestMessage{Reviewer: reviewer.Login, Text: text, Ref: ref})
+	}
+
+	if err := channelErrors(c, errs, sent); err != nil {
+		return err
+	}
+
+	presenceText := fmt.Sprintf(
+		"%s may be busy and unable to review %s",
+		buildLinkToUser(reviewer),
+		prLink(pr.HTMLURL, repo, pr),
+	)
+
+	// The review request itself has been delivered, so don't report a failed
+	// presence DM as an error: retrying would post the request twice.
+	if err := n.tryNotifyPresence(c, reviewer, pr.User, presenceText); err != nil {
+		ctx.Logger(c).Error("at", "notify_presence_error", "err", err)
+	}
+	return nil
+}
+
+// TeamReviewRequested mentions the Slack user group configured for the team,
+// in the pull request's channels as well as the team's own.
+func (n *SlackNotifier) TeamReviewRequested(c context.Context, repo *github.Repository, pr *github.PullRequest, team *github.Team) error {
 	text := fmt.Sprintf(
 		"%s you have been asked by %s to review %s",
-		buildLinkToUser(reviewer), buildUserName(pr.User),
+		buildLinkToTeam(team, n.router.Team(team.Slug)), buildUserName(pr.User),
 		prLink(pr.HTMLURL, repo, pr),
 	)
+	messageBlocks := reviewRequestBlocks(text, pullRequestKey(repo, pr), "@"+team.Slug)
 
-	messageBlocks := []slackapi.Block{buildTextMessageBlock(text)}
+	var errs []error
+	sent := 0
+	for _, channel := range n.router.TeamChannels(repo, pr, team.Slug) {
+		ref, err := n.notifyChannel(c, channel, messageBlocks)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sent++
+		n.rememberThread(c, channel, repo, pr, ref)
+		n.rememberReviewRequest(c, repo, pr, ReviewRequestMessage{Reviewer: "@" + team.Slug, Text: text, Ref: ref})
+	}
+	return channelErrors(c, errs, sent)
+}
 
-	// When a review is first requested, show some buttons for the reviewer to respond
-	buttonBlock := slackapi.NewActionBlock(
-		"reviewer_response",
-		slackapi.NewButtonBlockElement("", reviewingRequestStatusMsg, slackapi.NewTextBlockObject("plain_text", ":eyes: Looking", false, false)),
-		slackapi.NewButtonBlockElement("", unableToReviewStatusMsg, slackapi.NewTextBlockObject("plain_text", ":pray: Please reassign", false, false)),
+// ReviewRequestRemoved strikes through the messages that asked reviewer to
+// review the pull request, and replaces their buttons with a note saying who
+// withdrew the request.
+func (n *SlackNotifier) ReviewRequestRemoved(c context.Context, repo *github.Repository, pr *github.PullRequest, reviewer *github.User, sender *github.User) error {
+	if n.messages == nil {
+		return nil
+	}
+
+	key := pullRequestKey(repo, pr)
+	msgs, err := n.messages.ReviewRequestMessages(key)
+	if err != nil {
+		return err
+	}
+
+	response := fmt.Sprintf("Review request withdrawn by %s", buildUserName(sender))
+
+	var errs []error
+	for _, msg := range msgs {
+		if !strings.EqualFold(msg.Reviewer, reviewer.Login) {
+			continue
+		}
+
+		blocks := []slackapi.Block{buildTextMessageBlock(fmt.Sprintf("~%s~", msg.Text))}
+		if err := n.updateMessage(c, msg.Ref, rewriteBlocks(blocks, response)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	return n.messages.RemoveReviewRequestMessages(key, reviewer.Login)
+}
+
+// Merged marks the review requests for the pull request as done, and lets the
+// thread know who merged it and who gave cake.
+func (n *SlackNotifier) Merged(c context.Context, repo *github.Repository, pr *github.PullRequest, mergedBy *github.User) error {
+	status := fmt.Sprintf(":tada: Merged by %s", buildUserName(mergedBy))
+	return n.finishPullRequest(c, repo, pr, status, n.celebrateMerges)
+}
+
+// Closed marks the review requests for the pull request as no longer needed.
+func (n *SlackNotifier) Closed(c context.Context, repo *github.Repository, pr *github.PullRequest, closedBy *github.User) error {
+	status := fmt.Sprintf(":no_entry_sign: Closed by %s without merging", buildUserName(closedBy))
+	return n.finishPullRequest(c, repo, pr, status, false)
+}
+
+// finishPullRequest drops the buttons from the review requests for a pull
+// request that is no longer open, replies to its threads with the status, and
+// forgets about it. If celebrate is true the reply lists who gave cake, and is
+// posted even if there is no thread.
+func (n *SlackNotifier) finishPullRequest(c context.Context, repo *github.Repository, pr *github.PullRequest, status string, celebrate bool) error {
+	key := pullRequestKey(repo, pr)
+	text := fmt.Sprintf("%s: %s", status, prLink(pr.HTMLURL, repo, pr))
+
+	var (
+		errs []error
+		msgs []ReviewRequestMessage
+		// Without a message store we can't know who gave cake.
+		cakes []CakeMessage
 	)
 
-	messageBlocks = append(messageBlocks, buttonBlock)
+	if n.messages != nil {
+		var err error
+		if msgs, err = n.messages.ReviewRequestMessages(key); err != nil {
+			return err
+		}
+		if cakes, err = n.messages.CakeMessages(key); err != nil {
+			return err
+		}
+	}
+
+	for _, msg := range msgs {
+		blocks := []slackapi.Block{buildTextMessageBlock(msg.Text)}
+		if err := n.updateMessage(c, msg.Ref, rewriteBlocks(blocks, status)); err != nil {
+			errs = append(errs, err)
+		}
+	}
 
-	err := n.notifyChannel(c, notificationChannel, messageBlocks)
-	if err != nil {
+	if celebrate {
+		text = fmt.Sprintf("%s\n%s", text, cakeSummary(cakes))
+	}
+	messageBlocks := []slackapi.Block{buildTextMessageBlock(text)}
+
+	var postErrs []error
+	sent := 0
+	for _, channel := range n.router.Channels(repo, pr) {
+		if !celebrate && !n.hasThread(c, channel, key) {
+			continue
+		}
+
+		if _, err := n.notifyThread(c, channel, repo, pr, messageBlocks, n.broadcastReplies); err != nil {
+			postErrs = append(postErrs, err)
+			continue
+		}
+		sent++
+	}
+	errs = append(errs, channelErrors(c, postErrs, sent))
+
+	if err := errors.Join(errs...); err != nil {
 		return err
 	}
 
-	presenceText := fmt.Sprintf(
-		"%s may be busy and unable to review %s",
-		buildLinkToUser(reviewer),
+	if n.messages == nil {
+		return nil
+	}
+	return n.messages.DeletePullRequest(key)
+}
+
+// RemindReviewer asks the reviewer again, by direct message if they can be
+// found on Slack or in the pull request's threads otherwise. It returns
+// ErrReviewerOffline outside the reviewer's working hours or while they are
+// snoozing, so that the reminder can be sent later.
+func (n *SlackNotifier) RemindReviewer(c context.Context, review PendingReview) error {
+	repo, pr := review.Repository, review.PullRequest
+
+	text := fmt.Sprintf(
+		":alarm_clock: %s you were asked by %s to review %s %s ago",
+		buildLinkToUser(review.Reviewer), buildUserName(pr.User),
+		prLink(pr.HTMLURL, repo, pr), formatAge(n.now().Sub(review.RequestedAt)),
+	)
+
+	if reviewer := findSlackUser(review.Reviewer); reviewer != nil {
+		if next, _ := n.nextWorkingTime(review.Reviewer); next.After(n.now()) {
+			return ErrReviewerOffline
+		}
+		return n.notifyUserWithDM(c, reviewer.ID, reviewRequestBlocks(text, review.Key(), review.Reviewer.Login))
+	}
+
+	_, err := n.notifyThreads(c, repo, pr, []slackapi.Block{buildTextMessageBlock(text)})
+	return err
+}
+
+// EscalateReview lets the pull request's channels know that the reviewer
+// hasn't responded to the review request.
+func (n *SlackNotifier) EscalateReview(c context.Context, review PendingReview) error {
+	repo, pr := review.Repository, review.PullRequest
+
+	text := fmt.Sprintf(
+		":rotating_light: %s has been waiting %s for %s to review %s, can someone else help?",
+		buildLinkToUser(pr.User), formatAge(n.now().Sub(review.RequestedAt)),
+		buildUserName(review.Reviewer), prLink(pr.HTMLURL, repo, pr),
+	)
+
+	_, err := n.notifyThreadsWith(c, repo, pr, []slackapi.Block{buildTextMessageBlock(text)}, true)
+	return err
+}
+
+// ChannelDigest lists the pending reviews routed to channel, by reviewer.
+func (n *SlackNotifier) ChannelDigest(c context.Context, channel string, reviews []PendingReview) error {
+	header := fmt.Sprintf(":coffee: *%s waiting for review*", plural(len(reviews), "pull request"))
+	messageBlocks := []slackapi.Block{buildTextMessageBlock(header)}
+
+	var (
+		reviewers []string
+		byLogin   = make(map[string][]PendingReview)
+	)
+	for _, review := range reviews {
+		login := strings.ToLower(review.Reviewer.Login)
+		if _, ok := byLogin[login]; !ok {
+			reviewers = append(reviewers, login)
+		}
+		byLogin[login] = append(byLogin[login], review)
+	}
+
+	for i, login := range reviewers {
+		if i == maxDigestReviewers {
+			more := fmt.Sprintf("and %s more", plural(len(reviewers)-maxDigestReviewers, "reviewer"))
+			messageBlocks = append(messageBlocks, slackapi.NewContextBlock("", slackapi.NewTextBlockObject(slackapi.MarkdownType, more, false, false)))
+			break
+		}
+
+		mine := byLogin[login]
+		text := fmt.Sprintf("*%s*\n%s", buildUserName(mine[0].Reviewer), pendingReviewLines(mine, n.now()))
+		messageBlocks = append(messageBlocks, buildTextMessageBlock(text))
+	}
+
+	_, err := n.notifyChannel(c, channel, messageBlocks)
+	return err
+}
+
+// UserDigest sends the reviewer a direct message listing their pending
+// reviews.
+func (n *SlackNotifier) UserDigest(c context.Context, user *github.User, reviews []PendingReview) error {
+	header := fmt.Sprintf(":coffee: *You have %s waiting for your review*", plural(len(reviews), "pull request"))
+	messageBlocks := []slackapi.Block{buildTextMessageBlock(header), buildTextMessageBlock(pendingReviewLines(reviews, n.now()))}
+	return n.notifyUser(c, user, messageBlocks)
+}
+
+// pendingReviewLines describes each pending review on a line of its own.
+func pendingReviewLines(reviews []PendingReview, now time.Time) string {
+	var lines []string
+	for i, review := range reviews {
+		if i == maxDigestReviewsPerUser {
+			lines = append(lines, fmt.Sprintf("and %d more", len(reviews)-maxDigestReviewsPerUser))
+			break
+		}
+
+		line := fmt.Sprintf(
+			"• %s, requested %s ago",
+			prLink(review.PullRequest.HTMLURL, review.Repository, review.PullRequest),
+			formatAge(now.Sub(review.RequestedAt)),
+		)
+		switch review.Response {
+		case reviewingRequestStatusMsg:
+			line += " :eyes: Looking"
+		case unableToReviewStatusMsg:
+			line += " :pray: Please reassign"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Leaderboard posts the leaderboard to the channel.
+func (n *SlackNotifier) Leaderboard(c context.Context, channel string, board *Leaderboard) error {
+	_, err := n.notifyChannel(c, channel, leaderboardBlocks(board))
+	return err
+}
+
+// leaderboardBlocks describes the leaderboard, leaving out the parts that have
+// nothing to show.
+func leaderboardBlocks(board *Leaderboard) []slackapi.Block {
+	header := fmt.Sprintf(
+		":trophy: *Review leaderboard since %s*\n%s, %s given",
+		board.Since.Format("Mon 2 Jan"), plural(board.Reviews, "review"), plural(board.Cakes, "cake"),
+	)
+	messageBlocks := []slackapi.Block{buildTextMessageBlock(header)}
+
+	if len(board.MostCakes) > 0 {
+		lines := []string{"*Most cakes given*"}
+		for i, r := range board.MostCakes {
+			lines = append(lines, fmt.Sprintf("%d. %s, %s", i+1, buildUserName(&github.User{Login: r.Reviewer}), plural(r.Count, "cake")))
+		}
+		messageBlocks = append(messageBlocks, buildTextMessageBlock(strings.Join(lines, "\n")))
+	}
+
+	if len(board.Fastest) > 0 {
+		lines := []string{"*Fastest reviewers*"}
+		for i, r := range board.Fastest {
+			lines = append(lines, fmt.Sprintf(
+				"%d. %s, usually within %s (%s)",
+				i+1, buildUserName(&github.User{Login: r.Reviewer}), formatAge(r.Median), plural(r.Reviews, "review"),
+			))
+		}
+		messageBlocks = append(messageBlocks, buildTextMessageBlock(strings.Join(lines, "\n")))
+	}
+
+	if len(board.Waiting) > 0 {
+		lines := []string{"*Waiting longest*"}
+		for _, review := range board.Waiting {
+			lines = append(lines, fmt.Sprintf(
+				"• %s, waiting %s for %s",
+				prLink(review.PullRequest.HTMLURL, review.Repository, review.PullRequest),
+				formatAge(board.Until.Sub(review.RequestedAt)), buildUserName(review.Reviewer),
+			))
+		}
+		messageBlocks = append(messageBlocks, buildTextMessageBlock(strings.Join(lines, "\n")))
+	}
+	return messageBlocks
+}
+
+// plural describes a number of things, e.g. "1 day" or "2 days".
+func plural(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// formatAge describes how long ago something happened, roughly.
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Hour:
+		return plural(int(d.Minutes()), "minute")
+	case d < 48*time.Hour:
+		return plural(int(d.Hours()), "hour")
+	default:
+		return plural(int(d.Hours()/24), "day")
+	}
+}
+
+// cakeSummary thanks everyone who approved the pull request.
+func cakeSummary(cakes []CakeMessage) string {
+	var givers []string
+	for _, cake := range cakes {
+		name := fmt.Sprint(buildUserName(&github.User{Login: cake.Giver}))
+		if !slices.Contains(givers, name) {
+			givers = append(givers, name)
+		}
+	}
+
+	if len(givers) == 0 {
+		return "No :cake: was given this time."
+	}
+	return fmt.Sprintf("Thanks to %s for the :cake:", strings.Join(givers, ", "))
+}
+
+// CommentsPosted tells the people @mentioned in the comments, or the author of
+// the pull request if nobody is, about the comments.
+func (n *SlackNotifier) CommentsPosted(c context.Context, repo *github.Repository, pr *github.PullRequest, comments []*github.Comment) error {
+	recipients := commentRecipients(pr, comments)
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	var mentions []string
+	for _, r := range recipients {
+		mentions = append(mentions, buildLinkToUser(r))
+	}
+
+	noun := "a new comment"
+	if len(comments) > 1 {
+		noun = fmt.Sprintf("%d new comments", len(comments))
+	}
+
+	text := fmt.Sprintf(
+		"%s you have %s from %s on %s",
+		strings.Join(mentions, " "), noun, buildUserName(comments[0].User),
 		prLink(pr.HTMLURL, repo, pr),
 	)
 
-	return n.tryNotifyPresence(c, reviewer, pr.User, presenceText)
+	messageBlocks := []slackapi.Block{buildTextMessageBlock(text)}
+	for i, comment := range comments {
+		if i == maxCommentsPerMessage {
+			more := fmt.Sprintf("and %d more", len(comments)-maxCommentsPerMessage)
+			messageBlocks = append(messageBlocks, slackapi.NewContextBlock("", slackapi.NewTextBlockObject(slackapi.MarkdownType, more, false, false)))
+			break
+		}
+		messageBlocks = append(messageBlocks, buildTextMessageBlock(commentSnippet(comment)))
+	}
+
+	_, err := n.notifyThreads(c, repo, pr, messageBlocks)
+	return err
+}
+
+// commentRecipients returns who should hear about the comments: the users
+// they @mention, or else the author of the pull request. Nobody is told about
+// their own comments.
+func commentRecipients(pr *github.PullRequest, comments []*github.Comment) []*github.User {
+	var logins []string
+	add := func(login string, commenter *github.User) {
+		if commenter != nil && strings.EqualFold(login, commenter.Login) {
+			return
+		}
+		if !slices.ContainsFunc(logins, func(l string) bool { return strings.EqualFold(l, login) }) {
+			logins = append(logins, login)
+		}
+	}
+
+	for _, comment := range comments {
+		mentions := comment.Mentions()
+		for _, login := range mentions {
+			add(login, comment.User)
+		}
+
+		if len(mentions) == 0 && pr.User != nil {
+			add(pr.User.Login, comment.User)
+		}
+	}
+
+	var users []*github.User
+	for _, login := range logins {
+		users = append(users, &github.User{Login: login})
+	}
+	return users
+}
+
+// commentSnippet describes a comment with a link to it, the end of the diff
+// it was made on if any, and the start of its text.
+func commentSnippet(comment *github.Comment) string {
+	var b strings.Builder
+
+	if comment.Path != "" {
+		fmt.Fprintf(&b, "*<%s|%s>*\n", comment.HTMLURL, escapeSlackText(comment.Path))
+		if hunk := diffHunkContext(comment.DiffHunk); hunk != "" {
+			fmt.Fprintf(&b, "```%s```\n", escapeSlackText(hunk))
+		}
+	} else {
+		fmt.Fprintf(&b, "*<%s|Conversation>*\n", comment.HTMLURL)
+	}
+
+	b.WriteString(quoteSnippet(comment.Body))
+
+	return b.String()
+}
+
+// reviewBlocks returns the blocks for a message about a review, quoting the
+// start of the review's text if it has any.
+func reviewBlocks(text string, review *github.Review) []slackapi.Block {
+	blocks := []slackapi.Block{buildTextMessageBlock(text)}
+	if strings.TrimSpace(review.Body) != "" {
+		blocks = append(blocks, buildTextMessageBlock(quoteSnippet(review.Body)))
+	}
+	return blocks
+}
+
+// quoteSnippet returns the start of some user provided text as a quote.
+func quoteSnippet(text string) string {
+	body := strings.Join(strings.Fields(text), " ")
+	if runes := []rune(body); len(runes) > maxSnippetLength {
+		body = fmt.Sprintf("%s...", string(runes[:maxSnippetLength]))
+	}
+	return fmt.Sprintf("> %s", escapeSlackText(body))
+}
+
+// diffHunkContext returns the last few lines of a diff hunk, which end with
+// the line that was commented on.
+func diffHunkContext(hunk string) string {
+	lines := strings.Split(strings.TrimRight(hunk, "\n"), "\n")
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "@@") {
+		lines = lines[1:]
+	}
+	if len(lines) > maxDiffHunkLines {
+		lines = lines[len(lines)-maxDiffHunkLines:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// escapeSlackText escapes user provided text so that Slack doesn't interpret
+// it as links or mentions.
+// See https://api.slack.com/reference/surfaces/formatting#escaping
+func escapeSlackText(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
 }
 
 // Updates the original Slack message with a `context` block to show the status of the PR
@@ -101,8 +779,24 @@ func (n *SlackNotifier) ReviewRequested(c context.Context, repo *github.Reposito
 func (n *SlackNotifier) RespondToSlackAction(c context.Context, payload *slackapi.InteractionCallback, response string) error {
 	// We need to read the original message blocks and construct a new message
 	// otherwise `update` will overwrite everything, which we don't want.
-	msg := payload.Message
+	ref := MessageRef{Channel: payload.Channel.ID, Timestamp: payload.Message.Timestamp}
+	return n.updateMessage(c, ref, rewriteBlocks(payload.Message.Blocks.BlockSet, response))
+}
 
+// RespondEphemerally replies to the Slack action with a message that only the
+// user who took it can see.
+func (n *SlackNotifier) RespondEphemerally(c context.Context, payload *slackapi.InteractionCallback, response string) error {
+	opts := []slackapi.MsgOption{slackapi.MsgOptionBlocks(buildTextMessageBlock(response))}
+	if thread := payload.Message.ThreadTimestamp; thread != "" {
+		opts = append(opts, slackapi.MsgOptionTS(thread))
+	}
+	_, err := n.client.PostEphemeralContext(c, payload.Channel.ID, payload.User.ID, opts...)
+	return err
+}
+
+// rewriteBlocks drops the buttons from a message's blocks, and appends a
+// `context` block with the response text.
+func rewriteBlocks(blocks []slackapi.Block, response string) []slackapi.Block {
 	// The new block to add to the message
 	contextBlock := slackapi.NewContextBlock(
 		"",
@@ -111,21 +805,21 @@ func (n *SlackNotifier) RespondToSlackAction(c context.Context, payload *slackap
 
 	var newBlocks []slackapi.Block
 
-	for _, block := range msg.Blocks.BlockSet {
+	for _, block := range blocks {
 		// Drop the buttons, we're done with them now.
 		if block.BlockType() == "actions" {
 			continue
 		}
 		newBlocks = append(newBlocks, block)
 	}
-	newBlocks = append(newBlocks, contextBlock)
-
-	msg.Blocks.BlockSet = newBlocks
+	return append(newBlocks, contextBlock)
+}
 
+func (n *SlackNotifier) updateMessage(c context.Context, ref MessageRef, blocks []slackapi.Block) error {
 	_, _, _, err := n.client.UpdateMessageContext(c,
-		payload.Channel.ID,
-		payload.Message.Timestamp,
-		slackapi.MsgOptionBlocks(msg.Blocks.BlockSet...),
+		ref.Channel,
+		ref.Timestamp,
+		slackapi.MsgOptionBlocks(blocks...),
 	)
 	return err
 }
@@ -139,16 +833,155 @@ func (n *SlackNotifier) tryNotifyPresence(c context.Context, ghReviewer *github.
 	presence := n.findSlackUserStatus(reviewer)
 	// presence may be one of 'active', 'away' or a custom status text
 	if presence != "active" {
-		if reviewee := findSlackUser(ghReviewee); reviewee != nil {
-			return n.notifyUserWithDM(c, reviewee.ID, text)
-		}
+		return n.notifyUser(c, ghReviewee, []slackapi.Block{buildTextMessageBlock(text)})
 	}
 
 	return nil
 }
 
+// notifyUser sends a direct message to the Slack user matching the GitHub
+// user, if there is one. Outside their working hours the message is held until
+// they next start.
+func (n *SlackNotifier) notifyUser(c context.Context, ghUser *github.User, blocks []slackapi.Block) error {
+	user := findSlackUser(ghUser)
+	if user == nil {
+		return nil
+	}
+
+	if next, _ := n.nextWorkingTime(ghUser); n.held != nil && next.After(n.now()) {
+		ctx.Logger(c).Info("at", "direct_message_held", "user", ghUser.Login, "until", next)
+		return n.held.Hold(HeldMessage{UserID: user.ID, Blocks: slackapi.Blocks{BlockSet: blocks}, SendAt: next})
+	}
+	return n.notifyUserWithDM(c, user.ID, blocks)
+}
+
+// DirectMessage sends a direct message to the Slack user straight away.
+func (n *SlackNotifier) DirectMessage(c context.Context, userID string, blocks []slackapi.Block) error {
+	return n.notifyUserWithDM(c, userID, blocks)
+}
+
+// nextWorkingTime returns when the GitHub user is next working and not
+// snoozing, which is now if they are working or their working hours aren't
+// known, and the timezone they work in.
+func (n *SlackNotifier) nextWorkingTime(ghUser *github.User) (time.Time, *time.Location) {
+	now := n.now()
+	if ghUser == nil {
+		return now, time.UTC
+	}
+
+	var hours WorkingHours
+	if n.hours != nil {
+		hours = n.hours.For(ghUser.Login)
+	}
+	loc := hours.Location(findSlackUser(ghUser))
+
+	next := now
+	if until := n.snoozedUntil(ghUser); until.After(now) {
+		next = until
+	}
+	if n.hours != nil {
+		next = hours.Next(next, loc)
+	}
+	return next, loc
+}
+
+// Snooze holds direct messages and reminders for the GitHub user until the
+// given time, or stops snoozing if it has passed. Snoozes are lost if Cake Bot
+// restarts.
+func (n *SlackNotifier) Snooze(ghUser *github.User, until time.Time) {
+	n.snoozesMu.Lock()
+	defer n.snoozesMu.Unlock()
+
+	if until.After(n.now()) {
+		n.snoozes[strings.ToLower(ghUser.Login)] = until
+	} else {
+		delete(n.snoozes, strings.ToLower(ghUser.Login))
+	}
+}
+
+func (n *SlackNotifier) snoozedUntil(ghUser *github.User) time.Time {
+	n.snoozesMu.Lock()
+	defer n.snoozesMu.Unlock()
+
+	return n.snoozes[strings.ToLower(ghUser.Login)]
+}
+
+// offlineNote returns a context block saying that the reviewer is outside
+// their working hours or snoozing, or nil if they aren't.
+func (n *SlackNotifier) offlineNote(reviewer *github.User) slackapi.Block {
+	next, loc := n.nextWorkingTime(reviewer)
+	if !next.After(n.now()) {
+		return nil
+	}
+
+	text := fmt.Sprintf(
+		":zzz: %s is offline until %s (%s)",
+		buildUserName(reviewer), next.Format("Mon 15:04"), loc,
+	)
+	return slackapi.NewContextBlock("", slackapi.NewTextBlockObject(slackapi.MarkdownType, text, false, false))
+}
+
+// IsAvailable reports whether the user is within their working hours, not
+// snoozing and active on Slack. Users that can't be found on Slack are assumed to be.
+func (n *SlackNotifier) IsAvailable(ghUser *github.User) bool {
+	if next, _ := n.nextWorkingTime(ghUser); next.After(n.now()) {
+		return false
+	}
+
+	user := findSlackUser(ghUser)
+	if user == nil {
+		return true
+	}
+	return n.findSlackUserStatus(user) == "active"
+}
+
+// SuggestReviewer replies to the review request that a reviewer declined with
+// a button to ask someone else instead.
+func (n *SlackNotifier) SuggestReviewer(c context.Context, payload *slackapi.InteractionCallback, suggestion ReviewerSuggestion) error {
+	repo, pr := suggestion.Repository, suggestion.PullRequest
+
+	thread := payload.Message.ThreadTimestamp
+	if thread == "" {
+		thread = payload.Message.Timestamp
+	}
+
+	if suggestion.To == nil {
+		text := fmt.Sprintf(":shrug: Nobody else in the reviewer pool is available to review %s", prLink(pr.HTMLURL, repo, pr))
+		_, err := n.notifyChannel(c, payload.Channel.ID, []slackapi.Block{buildTextMessageBlock(text)}, slackapi.MsgOptionTS(thread))
+		return err
+	}
+
+	text := fmt.Sprintf(
+		":recycle: %s could review %s instead of %s",
+		buildUserName(suggestion.To), prLink(pr.HTMLURL, repo, pr), buildUserName(suggestion.From),
+	)
+	buttonBlock := slackapi.NewActionBlock(
+		buildReassignBlockID(pullRequestKey(repo, pr), suggestion.From.Login, suggestion.To.Login),
+		slackapi.NewButtonBlockElement("", reassignStatusMsg, slackapi.NewTextBlockObject("plain_text", fmt.Sprintf(":recycle: Ask %s", buildUserName(suggestion.To)), false, false)),
+	)
+
+	_, err := n.notifyChannel(c, payload.Channel.ID, []slackapi.Block{buildTextMessageBlock(text), buttonBlock}, slackapi.MsgOptionTS(thread))
+	return err
+}
+
+// SuggestReviewers lets the pull request's threads know who could review it,
+// without asking them.
+func (n *SlackNotifier) SuggestReviewers(c context.Context, repo *github.Repository, pr *github.PullRequest, reviewers []*github.User) error {
+	names := make([]string, len(reviewers))
+	for i, reviewer := range reviewers {
+		names[i] = fmt.Sprint(buildUserName(reviewer))
+	}
+
+	text := fmt.Sprintf(
+		":crystal_ball: Nobody has been asked to review %s yet, %s could review it",
+		prLink(pr.HTMLURL, repo, pr), strings.Join(names, " and "),
+	)
+	_, err := n.notifyThreads(c, repo, pr, []slackapi.Block{buildTextMessageBlock(text)})
+	return err
+}
+
 // Notifies a user with a direct message.
-func (n *SlackNotifier) notifyUserWithDM(c context.Context, userID, text string) error {
+func (n *SlackNotifier) notifyUserWithDM(c context.Context, userID string, blocks []slackapi.Block) error {
 	channel, _, _, err := n.client.OpenConversation(&slackapi.OpenConversationParameters{
 		Users: []string{userID},
 	})
@@ -156,24 +989,148 @@ func (n *SlackNotifier) notifyUserWithDM(c context.Context, userID, text string)
 		return err
 	}
 
-	messageBlocks := []slackapi.Block{buildTextMessageBlock(text)}
-	return n.notifyChannel(c, channel.ID, messageBlocks)
+	_, err = n.notifyChannel(c, channel.ID, blocks)
+	return err
+}
+
+// notifyThreads sends a message to the thread for the pull request in each of
+// the channels it is routed to.
+func (n *SlackNotifier) notifyThreads(c context.Context, repo *github.Repository, pr *github.PullRequest, blocks []slackapi.Block) ([]MessageRef, error) {
+	return n.notifyThreadsWith(c, repo, pr, blocks, n.broadcastReplies)
+}
+
+// notifyThreadsWith is notifyThreads, but broadcast decides whether replies are
+// also sent to the channel.
+func (n *SlackNotifier) notifyThreadsWith(c context.Context, repo *github.Repository, pr *github.PullRequest, blocks []slackapi.Block, broadcast bool) ([]MessageRef, error) {
+	var (
+		refs []MessageRef
+		errs []error
+	)
+
+	for _, channel := range n.router.Channels(repo, pr) {
+		ref, err := n.notifyThread(c, channel, repo, pr, blocks, broadcast)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	return refs, channelErrors(c, errs, len(refs))
+}
+
+// channelErrors returns the errors of posting a message to some channels only
+// if it couldn't be posted to any of them. Retrying after a partial failure
+// would post it again to the channels that did get it, so those errors are
+// logged instead.
+func channelErrors(c context.Context, errs []error, sent int) error {
+	if sent == 0 {
+		return errors.Join(errs...)
+	}
+	for _, err := range errs {
+		ctx.Logger(c).Error("at", "channel_error", "err", err)
+	}
+	return nil
+}
+
+// notifyThread sends a message as a reply to the thread for the pull request,
+// or as a new message that starts the thread if there isn't one yet. If
+// broadcast is true a reply is also sent to the channel.
+func (n *SlackNotifier) notifyThread(c context.Context, channel string, repo *github.Repository, pr *github.PullRequest, blocks []slackapi.Block, broadcast bool) (MessageRef, error) {
+	if !n.threads || n.messages == nil {
+		return n.notifyChannel(c, channel, blocks)
+	}
+
+	thread, err := n.messages.Thread(channel, pullRequestKey(repo, pr))
+	if err != nil {
+		ctx.Logger(c).Error("at", "message_store_error", "err", err)
+	}
+
+	if thread == nil {
+		ref, err := n.notifyChannel(c, channel, blocks)
+		if err != nil {
+			return ref, err
+		}
+		n.rememberThread(c, channel, repo, pr, ref)
+		return ref, nil
+	}
+
+	opts := []slackapi.MsgOption{slackapi.MsgOptionTS(thread.Timestamp)}
+	if broadcast {
+		opts = append(opts, slackapi.MsgOptionBroadcast())
+	}
+
+	return n.notifyChannel(c, thread.Channel, blocks, opts...)
+}
+
+// hasThread reports whether messages are threaded and a thread has been
+// started for the pull request in channel.
+func (n *SlackNotifier) hasThread(c context.Context, channel string, pr PullRequestKey) bool {
+	if !n.threads || n.messages == nil {
+		return false
+	}
+
+	thread, err := n.messages.Thread(channel, pr)
+	if err != nil {
+		ctx.Logger(c).Error("at", "message_store_error", "err", err)
+	}
+	return thread != nil
+}
+
+// rememberThread records ref as the start of the thread for the pull request,
+// unless a thread has already been started.
+func (n *SlackNotifier) rememberThread(c context.Context, channel string, repo *github.Repository, pr *github.PullRequest, ref MessageRef) {
+	if n.messages == nil {
+		return
+	}
+
+	key := pullRequestKey(repo, pr)
+	if thread, err := n.messages.Thread(channel, key); err != nil || thread != nil {
+		return
+	}
+
+	if err := n.messages.SetThread(channel, key, ref); err != nil {
+		ctx.Logger(c).Error("at", "message_store_error", "err", err)
+	}
 }
 
-// notifyChannel sends a message to a channel constructed from blocks
+// rememberReview records the state of a review of the pull request.
+func (n *SlackNotifier) rememberReview(c context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review) {
+	if n.messages == nil {
+		return
+	}
+
+	if err := n.messages.SetReview(pullRequestKey(repo, pr), review); err != nil {
+		ctx.Logger(c).Error("at", "message_store_error", "err", err)
+	}
+}
+
+// rememberReviewRequest records a message asking for a review of the pull
+// request.
+func (n *SlackNotifier) rememberReviewRequest(c context.Context, repo *github.Repository, pr *github.PullRequest, msg ReviewRequestMessage) {
+	if n.messages == nil {
+		return
+	}
+
+	if err := n.messages.AddReviewRequestMessage(pullRequestKey(repo, pr), msg); err != nil {
+		ctx.Logger(c).Error("at", "message_store_error", "err", err)
+	}
+}
+
+// notifyChannel sends a message to a channel constructed from blocks, and
+// returns a reference to the posted message.
 // Callers should pass the channel ID, not the channel name (e.g. "C1234567890")
-func (n *SlackNotifier) notifyChannel(c context.Context, channel string, blocks []slackapi.Block) error {
+func (n *SlackNotifier) notifyChannel(c context.Context, channel string, blocks []slackapi.Block, opts ...slackapi.MsgOption) (MessageRef, error) {
 	params := slackapi.NewPostMessageParameters()
 	params.AsUser = true
 	params.EscapeText = false
 
-	_, _, err := n.client.PostMessageContext(
-		c,
-		channel,
+	opts = append([]slackapi.MsgOption{
 		slackapi.MsgOptionBlocks(blocks...),
 		slackapi.MsgOptionPostMessageParameters(params),
-	)
-	return err
+	}, opts...)
+
+	channelID, ts, err := n.client.PostMessageContext(c, channel, opts...)
+	return MessageRef{Channel: channelID, Timestamp: ts}, err
 }
 
 // findSlackUserStatus returns the status of a Slack user.
@@ -202,7 +1159,70 @@ func (n *SlackNotifier) findSlackUserStatus(user *slackapi.User) string {
 	return u.Presence // 'active'
 }
 
+// reviewRequestBlocks returns the blocks asking reviewer for a review of the
+// pull request, with buttons for the reviewer to respond.
+func reviewRequestBlocks(text string, pr PullRequestKey, reviewer string) []slackapi.Block {
+	buttonBlock := slackapi.NewActionBlock(
+		buildReviewerResponseBlockID(pr, reviewer),
+		slackapi.NewButtonBlockElement("", reviewingRequestStatusMsg, slackapi.NewTextBlockObject("plain_text", ":eyes: Looking", false, false)),
+		slackapi.NewButtonBlockElement("", unableToReviewStatusMsg, slackapi.NewTextBlockObject("plain_text", ":pray: Please reassign", false, false)),
+	)
+
+	return []slackapi.Block{buildTextMessageBlock(text), buttonBlock}
+}
+
+// buildReviewerResponseBlockID identifies the review request that the buttons
+// of a message respond to.
+func buildReviewerResponseBlockID(pr PullRequestKey, reviewer string) string {
+	return fmt.Sprintf("%s|%s|%s", reviewerResponseBlockID, pr, reviewer)
+}
+
+// parseReviewerResponseBlockID returns the pull request and reviewer that the
+// buttons in a block respond to. Messages posted before the block ID included
+// them can't be parsed.
+func parseReviewerResponseBlockID(id string) (PullRequestKey, string, bool) {
+	parts := strings.Split(id, "|")
+	if len(parts) != 3 || parts[0] != reviewerResponseBlockID {
+		return PullRequestKey{}, "", false
+	}
+
+	pr, err := ParsePullRequestKey(parts[1])
+	if err != nil {
+		return PullRequestKey{}, "", false
+	}
+	return pr, parts[2], true
+}
+
+// buildReassignBlockID identifies the review request that the button of a
+// reviewer suggestion moves from one reviewer to another.
+func buildReassignBlockID(pr PullRequestKey, from, to string) string {
+	return fmt.Sprintf("%s|%s|%s|%s", reassignBlockID, pr, from, to)
+}
+
+func parseReassignBlockID(id string) (pr PullRequestKey, from, to string, ok bool) {
+	parts := strings.Split(id, "|")
+	if len(parts) != 4 || parts[0] != reassignBlockID {
+		return PullRequestKey{}, "", "", false
+	}
+
+	pr, err := ParsePullRequestKey(parts[1])
+	if err != nil {
+		return PullRequestKey{}, "", "", false
+	}
+	return pr, parts[2], parts[3], true
+}
+
+func buildLinkToTeam(team *github.Team, route TeamRoute) string {
+	if route.UserGroup != "" {
+		return fmt.Sprintf("<!subteam^%s>", route.UserGroup)
+	}
+	return fmt.Sprintf("@%s", team.Name)
+}
+
 func buildLinkToUser(ghUser *github.User) string {
+	if ghUser == nil {
+		return "someone"
+	}
 	if user := findSlackUser(ghUser); user != nil {
 		return fmt.Sprintf("<@%s>", user.ID)
 	}
@@ -210,6 +1230,9 @@ func buildLinkToUser(ghUser *github.User) string {
 }
 
 func buildUserName(ghUser *github.User) interface{} {
+	if ghUser == nil {
+		return "someone"
+	}
 	if user := findSlackUser(ghUser); user != nil {
 		return user.Name
 	}
@@ -217,9 +1240,24 @@ func buildUserName(ghUser *github.User) interface{} {
 }
 
 func findSlackUser(ghUser *github.User) *slackapi.User {
+	if ghUser == nil {
+		return nil
+	}
 	return slack.Users.FindByGitHubUsername(ghUser.Login)
 }
 
+func reviewRequestedText(repo *github.Repository, pr *github.PullRequest, reviewer *github.User) string {
+	return fmt.Sprintf(
+		"%s you have been asked by %s to review %s",
+		buildLinkToUser(reviewer), buildUserName(pr.User),
+		prLink(pr.HTMLURL, repo, pr),
+	)
+}
+
+func pullRequestKey(repo *github.Repository, pr *github.PullRequest) PullRequestKey {
+	return PullRequestKey{Repo: repo.FullName, Number: pr.Number}
+}
+
 func prLink(url string, repo *github.Repository, pr *github.PullRequest) string {
 	title := pr.Title
 	if len(title) > maxTitleLength {
@@ -0,0 +1,648 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/geckoboard/cake-bot/github"
+	"github.com/geckoboard/cake-bot/store"
+	slackapi "github.com/slack-go/slack"
+)
+
+type slackCall struct {
+	method string
+	values url.Values
+}
+
+// fakeSlackAPI records the Slack Web API calls made by the SlackNotifier and
+// responds as successfully as Slack would.
+type fakeSlackAPI struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	calls []slackCall
+	ts    int
+	// failing are the channels that messages can't be posted to.
+	failing map[string]bool
+}
+
+func newFakeSlackAPI(t *testing.T) *fakeSlackAPI {
+	f := &fakeSlackAPI{}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeSlackAPI) client() *slackapi.Client {
+	return slackapi.New("xoxb-test", slackapi.OptionAPIURL(f.URL+"/"))
+}
+
+func (f *fakeSlackAPI) handle(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	method := strings.TrimPrefix(r.URL.Path, "/")
+
+	f.mu.Lock()
+	f.calls = append(f.calls, slackCall{method, r.PostForm})
+	f.ts++
+	ts := fmt.Sprintf("1700000000.%06d", f.ts)
+	failing := f.failing[r.PostForm.Get("channel")]
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if method == "chat.postMessage" && failing {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "channel_not_found"})
+		return
+	}
+
+	switch method {
+	case "chat.postMessage", "chat.update":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok": true, "channel": "C123", "ts": ts,
+		})
+	case "conversations.open":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok": true, "channel": map[string]interface{}{"id": "D123"},
+		})
+	case "users.info":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok": true, "user": map[string]interface{}{"id": r.PostForm.Get("user"), "presence": "active"},
+		})
+	default:
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+	}
+}
+
+// callsTo returns the parameters of the calls made to a Slack API method.
+func (f *fakeSlackAPI) callsTo(method string) []url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var calls []url.Values
+	for _, c := range f.calls {
+		if c.method == method {
+			calls = append(calls, c.values)
+		}
+	}
+	return calls
+}
+
+// blocks returns the blocks of a chat.postMessage or chat.update call as JSON,
+// without the HTML escaping that Slack doesn't need.
+func blocks(t *testing.T, call url.Values) string {
+	t.Helper()
+
+	var v interface{}
+	if err := json.Unmarshal([]byte(call.Get("blocks")), &v); err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+// posts returns the chat.postMessage calls that have been made.
+func (f *fakeSlackAPI) posts() []url.Values {
+	return f.callsTo("chat.postMessage")
+}
+
+func TestSlackNotifierThreadsPullRequestNotifications(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	n := NewSlackNotifier(api.client(), NewChannelRouter("#devs"), WithMessageStore(NewStoreMessageStore(store.NewMemory())), WithThreads(true))
+	c := context.Background()
+
+	if err := n.ReviewRequested(c, testRepo, testPR, testReview.User); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.ChangesRequested(c, testRepo, testPR, testReview); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Approved(c, testRepo, testPR, testReview); err != nil {
+		t.Fatal(err)
+	}
+
+	posts := api.posts()
+	if len(posts) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(posts))
+	}
+
+	if posts[0].Get("thread_ts") != "" {
+		t.Fatalf("expected the review request to start a thread, got thread_ts %q", posts[0].Get("thread_ts"))
+	}
+
+	for _, p := range posts[1:] {
+		if p.Get("thread_ts") != "1700000000.000001" {
+			t.Errorf("expected reply in thread 1700000000.000001, got %q", p.Get("thread_ts"))
+		}
+		if p.Get("reply_broadcast") != "true" {
+			t.Errorf("expected reply to be broadcast to the channel")
+		}
+	}
+}
+
+func TestSlackNotifierWithoutThreads(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	n := NewSlackNotifier(api.client(), NewChannelRouter("#devs"))
+
+	if err := n.Approved(context.Background(), testRepo, testPR, testReview); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Approved(context.Background(), testRepo, testPR, testReview); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range api.posts() {
+		if p.Get("thread_ts") != "" {
+			t.Errorf("expected a top-level message, got thread_ts %q", p.Get("thread_ts"))
+		}
+	}
+}
+
+func TestSlackNotifierOnlyFailsWhenEveryChannelFails(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	api.failing = map[string]bool{"#cake": true}
+	router := &ChannelRouter{Default: []string{"#devs", "#cake"}}
+	n := NewSlackNotifier(api.client(), router, WithMessageStore(NewStoreMessageStore(store.NewMemory())))
+	c := context.Background()
+
+	// Retrying would post to #devs again.
+	if err := n.ReviewRequested(c, testRepo, testPR, testReview.User); err != nil {
+		t.Errorf("expected a partial failure not to be returned, got: %v", err)
+	}
+	if err := n.Approved(c, testRepo, testPR, testReview); err != nil {
+		t.Errorf("expected a partial failure not to be returned, got: %v", err)
+	}
+
+	api.failing["#devs"] = true
+	if err := n.ReviewRequested(c, testRepo, testPR, testReview.User); err == nil {
+		t.Error("expected the failure to be returned when every channel fails")
+	}
+}
+
+func TestSlackNotifierReviewRequestRemoved(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	router := &ChannelRouter{Default: []string{"#devs", "#cake"}}
+	n := NewSlackNotifier(api.client(), router, WithMessageStore(NewStoreMessageStore(store.NewMemory())))
+	c := context.Background()
+
+	if err := n.ReviewRequested(c, testRepo, testPR, testReview.User); err != nil {
+		t.Fatal(err)
+	}
+
+	sender := &github.User{Login: "author", ID: 1}
+	if err := n.ReviewRequestRemoved(c, testRepo, testPR, testReview.User, sender); err != nil {
+		t.Fatal(err)
+	}
+
+	updates := api.callsTo("chat.update")
+	if len(updates) != 2 {
+		t.Fatalf("expected the message in each channel to be updated, got %d updates", len(updates))
+	}
+
+	for _, u := range updates {
+		blocks := blocks(t, u)
+		if strings.Contains(blocks, `"actions"`) {
+			t.Errorf("expected the buttons to be removed, got blocks: %s", blocks)
+		}
+		if !strings.Contains(blocks, "~reviewer you have been asked") {
+			t.Errorf("expected the request to be struck through, got blocks: %s", blocks)
+		}
+		if !strings.Contains(blocks, "Review request withdrawn by author") {
+			t.Errorf("expected a note about who withdrew the request, got blocks: %s", blocks)
+		}
+	}
+
+	// Withdrawing the request again has nothing left to update.
+	if err := n.ReviewRequestRemoved(c, testRepo, testPR, testReview.User, sender); err != nil {
+		t.Fatal(err)
+	}
+
+	if updates := api.callsTo("chat.update"); len(updates) != 2 {
+		t.Fatalf("expected no further updates, got %d updates", len(updates))
+	}
+}
+
+func TestSlackNotifierTeamReviewRequestRemoved(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	router := &ChannelRouter{Default: []string{"#devs"}}
+	n := NewSlackNotifier(api.client(), router, WithMessageStore(NewStoreMessageStore(store.NewMemory())))
+	c := context.Background()
+
+	if err := n.ReviewRequested(c, testRepo, testPR, testReview.User); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.TeamReviewRequested(c, testRepo, testPR, &github.Team{Slug: "backend", Name: "Backend"}); err != nil {
+		t.Fatal(err)
+	}
+
+	sender := &github.User{Login: "author", ID: 1}
+	if err := n.ReviewRequestRemoved(c, testRepo, testPR, &github.User{Login: "@backend"}, sender); err != nil {
+		t.Fatal(err)
+	}
+
+	updates := api.callsTo("chat.update")
+	if len(updates) != 1 {
+		t.Fatalf("expected only the team's message to be updated, got %d updates", len(updates))
+	}
+	if blocks := blocks(t, updates[0]); !strings.Contains(blocks, "Review request withdrawn by author") {
+		t.Errorf("expected a note about who withdrew the request, got blocks: %s", blocks)
+	}
+}
+
+func TestSlackNotifierTeamReviewRequested(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	router := &ChannelRouter{
+		Default: []string{"#devs"},
+		Teams:   map[string]TeamRoute{"backend": {UserGroup: "S0123", Channels: []string{"#backend"}}},
+	}
+	n := NewSlackNotifier(api.client(), router)
+
+	team := &github.Team{ID: 1, Name: "Backend", Slug: "backend"}
+	if err := n.TeamReviewRequested(context.Background(), testRepo, testPR, team); err != nil {
+		t.Fatal(err)
+	}
+
+	posts := api.posts()
+	if len(posts) != 2 || posts[0].Get("channel") != "#devs" || posts[1].Get("channel") != "#backend" {
+		t.Fatalf("expected the request to be posted to #devs and #backend, got: %v", posts)
+	}
+
+	if blocks := blocks(t, posts[0]); !strings.Contains(blocks, "<!subteam^S0123> you have been asked") {
+		t.Errorf("expected the user group to be mentioned, got blocks: %s", blocks)
+	}
+}
+
+func TestSlackNotifierMerged(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	store := NewStoreMessageStore(store.NewMemory())
+	n := NewSlackNotifier(api.client(), NewChannelRouter("#devs"), WithMessageStore(store), WithThreads(false), WithMergeCelebration())
+	c := context.Background()
+
+	if err := n.ReviewRequested(c, testRepo, testPR, testReview.User); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Approved(c, testRepo, testPR, testReview); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Merged(c, testRepo, testPR, testPR.User); err != nil {
+		t.Fatal(err)
+	}
+
+	updates := api.callsTo("chat.update")
+	if len(updates) != 1 {
+		t.Fatalf("expected the review request to be updated, got %d updates", len(updates))
+	}
+
+	if blocks := blocks(t, updates[0]); strings.Contains(blocks, `"actions"`) || !strings.Contains(blocks, "Merged by author") {
+		t.Errorf("expected the review request to be marked as merged without buttons, got blocks: %s", blocks)
+	}
+
+	posts := api.posts()
+	if len(posts) != 3 {
+		t.Fatalf("expected a summary to be posted, got %d messages", len(posts))
+	}
+
+	summary := posts[2]
+	if summary.Get("thread_ts") != "1700000000.000001" {
+		t.Errorf("expected the summary to be posted in the thread, got thread_ts %q", summary.Get("thread_ts"))
+	}
+	if blocks := blocks(t, summary); !strings.Contains(blocks, "Thanks to reviewer for the :cake:") {
+		t.Errorf("expected the summary to thank the reviewer, got blocks: %s", blocks)
+	}
+
+	if msgs, _ := store.ReviewRequestMessages(pullRequestKey(testRepo, testPR)); len(msgs) != 0 {
+		t.Errorf("expected the pull request to be forgotten, got: %#v", msgs)
+	}
+}
+
+func TestSlackNotifierClosedWithoutThread(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	n := NewSlackNotifier(api.client(), NewChannelRouter("#devs"), WithMessageStore(NewStoreMessageStore(store.NewMemory())))
+	c := context.Background()
+
+	if err := n.ReviewRequested(c, testRepo, testPR, testReview.User); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Closed(c, testRepo, testPR, testPR.User); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(api.callsTo("chat.update")) != 1 {
+		t.Fatal("expected the review request to be updated")
+	}
+
+	if posts := api.posts(); len(posts) != 1 {
+		t.Fatalf("expected nothing to be posted without a thread, got %d messages", len(posts))
+	}
+}
+
+func TestSlackNotifierCommentsPosted(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	n := NewSlackNotifier(api.client(), NewChannelRouter("#devs"))
+	reviewer := testReview.User
+
+	comments := []*github.Comment{
+		{User: reviewer, Body: "Needs <!channel> improvement", Path: "README.md", DiffHunk: "@@ -1,2 +1,2 @@\n-foo\n+bar", HTMLURL: "https://github.com/c/1"},
+		{User: reviewer, Body: "And this", Path: "main.go", HTMLURL: "https://github.com/c/2"},
+	}
+	if err := n.CommentsPosted(context.Background(), testRepo, testPR, comments); err != nil {
+		t.Fatal(err)
+	}
+
+	posts := api.posts()
+	if len(posts) != 1 {
+		t.Fatalf("expected 1 message for the batch, got %d", len(posts))
+	}
+
+	b := blocks(t, posts[0])
+	for _, expected := range []string{
+		"author you have 2 new comments from reviewer",
+		"<https://github.com/c/1|README.md>",
+		"```-foo\\n+bar```",
+		"> Needs &lt;!channel&gt; improvement",
+	} {
+		if !strings.Contains(b, expected) {
+			t.Errorf("expected message to contain %q, got blocks: %s", expected, b)
+		}
+	}
+}
+
+func TestCommentRecipients(t *testing.T) {
+	author := testPR.User
+	reviewer := testReview.User
+
+	cases := []struct {
+		name     string
+		comments []*github.Comment
+		expected []string
+	}{
+		{"author is told about comments", []*github.Comment{{User: reviewer, Body: "Hmm"}}, []string{"author"}},
+		{"mentions replace the author", []*github.Comment{{User: reviewer, Body: "@someone?"}}, []string{"someone"}},
+		{"nobody is told about their own comments", []*github.Comment{{User: author, Body: "Done, @author"}}, nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, u := range commentRecipients(testPR, tc.comments) {
+				got = append(got, u.Login)
+			}
+
+			if strings.Join(got, ",") != strings.Join(tc.expected, ",") {
+				t.Fatalf("expected recipients %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestSlackNotifierReviewDismissed(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	store := NewStoreMessageStore(store.NewMemory())
+	n := NewSlackNotifier(api.client(), NewChannelRouter("#devs"), WithMessageStore(store), WithThreads(false))
+	c := context.Background()
+
+	if err := n.Approved(c, testRepo, testPR, testReview); err != nil {
+		t.Fatal(err)
+	}
+
+	dismissed := *testReview
+	dismissed.State = "dismissed"
+	if err := n.ReviewDismissed(c, testRepo, testPR, &dismissed, testPR.User); err != nil {
+		t.Fatal(err)
+	}
+
+	updates := api.callsTo("chat.update")
+	if len(updates) != 1 {
+		t.Fatalf("expected the cake message to be updated, got %d updates", len(updates))
+	}
+	if b := blocks(t, updates[0]); !strings.Contains(b, "~author you have received a :cake:") || !strings.Contains(b, "Approval dismissed by author") {
+		t.Errorf("expected the cake to be struck through, got blocks: %s", b)
+	}
+
+	posts := api.posts()
+	if len(posts) != 2 {
+		t.Fatalf("expected the author to be notified, got %d messages", len(posts))
+	}
+	if b := blocks(t, posts[1]); !strings.Contains(b, "author the approval from reviewer") {
+		t.Errorf("unexpected notification: %s", b)
+	}
+
+	key := pullRequestKey(testRepo, testPR)
+	if cakes, _ := store.CakeMessages(key); len(cakes) != 0 {
+		t.Errorf("expected the dismissed cake to be forgotten, got: %#v", cakes)
+	}
+	if review, _ := store.Review(key, testReview.ID); review == nil || review.State != "dismissed" {
+		t.Errorf("expected the review state to be updated, got: %#v", review)
+	}
+}
+
+func TestSlackNotifierChangesRequestedAndCommented(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	n := NewSlackNotifier(api.client(), NewChannelRouter("#devs"), WithMessageStore(NewStoreMessageStore(store.NewMemory())), WithThreads(false))
+	c := context.Background()
+
+	if err := n.ReviewRequested(c, testRepo, testPR, testReview.User); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := *testReview
+	changes.State = "changes_requested"
+	changes.Body = "Please add a test"
+	if err := n.ChangesRequested(c, testRepo, testPR, &changes); err != nil {
+		t.Fatal(err)
+	}
+
+	commented := *testReview
+	commented.State = "commented"
+	if err := n.Commented(c, testRepo, testPR, &commented); err != nil {
+		t.Fatal(err)
+	}
+
+	posts := api.posts()
+	if len(posts) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(posts))
+	}
+
+	if b := blocks(t, posts[1]); !strings.Contains(b, ":no_entry: author changes have been requested by reviewer") || !strings.Contains(b, "> Please add a test") {
+		t.Errorf("unexpected changes requested message: %s", b)
+	}
+	if posts[1].Get("reply_broadcast") != "true" {
+		t.Errorf("expected changes requested to be broadcast to the channel")
+	}
+
+	if b := blocks(t, posts[2]); !strings.Contains(b, ":speech_balloon: author reviewer has left a review") || strings.Count(b, `"type":"section"`) != 1 {
+		t.Errorf("unexpected commented message: %s", b)
+	}
+	if posts[2].Get("reply_broadcast") != "" {
+		t.Errorf("expected the comment to only be posted in the thread")
+	}
+}
+
+func TestSlackNotifierEscalateReview(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	n := NewSlackNotifier(api.client(), NewChannelRouter("#devs"))
+
+	requestedAt := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	n.now = func() time.Time { return requestedAt.Add(50 * time.Hour) }
+
+	review := PendingReview{Repository: testRepo, PullRequest: testPR, Reviewer: testReview.User, RequestedAt: requestedAt}
+	if err := n.EscalateReview(context.Background(), review); err != nil {
+		t.Fatal(err)
+	}
+
+	posts := api.posts()
+	if len(posts) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(posts))
+	}
+	if b := blocks(t, posts[0]); !strings.Contains(b, "author has been waiting 2 days for reviewer to review") {
+		t.Errorf("unexpected escalation: %s", b)
+	}
+}
+
+func TestReviewerResponseBlockID(t *testing.T) {
+	key := PullRequestKey{Repo: "geckoboard/cake-bot", Number: 12}
+
+	pr, reviewer, ok := parseReviewerResponseBlockID(buildReviewerResponseBlockID(key, "@backend"))
+	if !ok || pr != key || reviewer != "@backend" {
+		t.Fatalf("unexpected pull request %v and reviewer %q", pr, reviewer)
+	}
+
+	if _, _, ok := parseReviewerResponseBlockID("reviewer_response"); ok {
+		t.Fatal("expected the block ID of older messages not to parse")
+	}
+}
+
+func TestSlackNotifierReviewRequestedOutsideWorkingHours(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	hours := &WorkingHoursConfig{Default: WorkingHours{Start: "09:00", End: "17:00", Timezone: "UTC"}}
+	n := NewSlackNotifier(api.client(), NewChannelRouter("#devs"), WithWorkingHours(hours))
+	n.now = func() time.Time { return time.Date(2024, 1, 3, 3, 0, 0, 0, time.UTC) }
+
+	if err := n.ReviewRequested(context.Background(), testRepo, testPR, testReview.User); err != nil {
+		t.Fatal(err)
+	}
+
+	posts := api.posts()
+	if len(posts) != 1 {
+		t.Fatalf("expected the request to be posted straight away, got %d messages", len(posts))
+	}
+	if b := blocks(t, posts[0]); !strings.Contains(b, ":zzz: reviewer is offline until Wed 09:00 (UTC)") {
+		t.Errorf("expected a note that the reviewer is offline, got blocks: %s", b)
+	}
+
+	n.now = func() time.Time { return time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC) }
+	if err := n.ReviewRequested(context.Background(), testRepo, testPR, testReview.User); err != nil {
+		t.Fatal(err)
+	}
+	if b := blocks(t, api.posts()[1]); strings.Contains(b, ":zzz:") {
+		t.Errorf("expected no note during working hours, got blocks: %s", b)
+	}
+}
+
+func TestSlackNotifierChannelDigest(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	n := NewSlackNotifier(api.client(), NewChannelRouter("#devs"))
+
+	requestedAt := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	n.now = func() time.Time { return requestedAt.Add(3 * time.Hour) }
+
+	other := &github.PullRequest{Number: 13, Title: "Add more cake", User: testPR.User}
+	reviews := []PendingReview{
+		{Repository: testRepo, PullRequest: testPR, Reviewer: testReview.User, RequestedAt: requestedAt, Response: reviewingRequestStatusMsg},
+		{Repository: testRepo, PullRequest: other, Reviewer: &github.User{Login: "busy"}, RequestedAt: requestedAt},
+		{Repository: testRepo, PullRequest: other, Reviewer: testReview.User, RequestedAt: requestedAt},
+	}
+	if err := n.ChannelDigest(context.Background(), "#devs", reviews); err != nil {
+		t.Fatal(err)
+	}
+
+	posts := api.posts()
+	if len(posts) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(posts))
+	}
+
+	b := blocks(t, posts[0])
+	for _, want := range []string{
+		"3 pull requests waiting for review",
+		"*reviewer*\\n• <|cake-bot#12> - Add cake, requested 3 hours ago :eyes: Looking\\n• <|cake-bot#13> - Add more cake",
+		"*busy*\\n• <|cake-bot#13>",
+	} {
+		if !strings.Contains(b, want) {
+			t.Errorf("expected digest to contain %q, got blocks: %s", want, b)
+		}
+	}
+}
+
+func TestSlackNotifierLeaderboard(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	n := NewSlackNotifier(api.client(), NewChannelRouter("#devs"))
+
+	since := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	board := &Leaderboard{
+		Since:     since,
+		Until:     since.AddDate(0, 0, 7),
+		Reviews:   4,
+		Cakes:     3,
+		MostCakes: []ReviewerCount{{Reviewer: "reviewer", Count: 3}},
+		Fastest:   []ReviewerTime{{Reviewer: "reviewer", Reviews: 2, Median: 90 * time.Minute}},
+		Waiting:   []PendingReview{{Repository: testRepo, PullRequest: testPR, Reviewer: testReview.User, RequestedAt: since.AddDate(0, 0, 4)}},
+	}
+	if err := n.Leaderboard(context.Background(), "#devs", board); err != nil {
+		t.Fatal(err)
+	}
+
+	posts := api.posts()
+	if len(posts) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(posts))
+	}
+
+	b := blocks(t, posts[0])
+	for _, want := range []string{
+		"Review leaderboard since Mon 1 Jan*\\n4 reviews, 3 cakes given",
+		"*Most cakes given*\\n1. reviewer, 3 cakes",
+		"*Fastest reviewers*\\n1. reviewer, usually within 1 hour (2 reviews)",
+		"*Waiting longest*\\n• <|cake-bot#12> - Add cake, waiting 3 days for reviewer",
+	} {
+		if !strings.Contains(b, want) {
+			t.Errorf("expected leaderboard to contain %q, got blocks: %s", want, b)
+		}
+	}
+}
+
+func TestSlackNotifierSnooze(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	n := NewSlackNotifier(api.client(), NewChannelRouter("#devs"))
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	n.now = func() time.Time { return now }
+
+	n.Snooze(testReview.User, now.Add(2*time.Hour))
+	if n.IsAvailable(&github.User{Login: "Reviewer"}) {
+		t.Error("expected the reviewer to be unavailable while snoozing")
+	}
+
+	if err := n.ReviewRequested(context.Background(), testRepo, testPR, testReview.User); err != nil {
+		t.Fatal(err)
+	}
+	if b := blocks(t, api.posts()[0]); !strings.Contains(b, ":zzz: reviewer is offline until Mon 14:00 (UTC)") {
+		t.Errorf("expected the review request to say the reviewer is snoozing, got blocks: %s", b)
+	}
+
+	n.Snooze(testReview.User, time.Time{})
+	if !n.IsAvailable(testReview.User) {
+		t.Error("expected the reviewer to be available once they stop snoozing")
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// UserOverrides maps GitHub logins to Slack users explicitly, for people who
+// haven't put their GitHub username in their Slack profile or who have
+// several GitHub accounts.
+type UserOverrides struct {
+	// Users maps GitHub logins to the ID of a Slack user, e.g. "U024BE7LH",
+	// or the email in their Slack profile.
+	Users map[string]string `json:"users"`
+}
+
+var slackUserID = regexp.MustCompile(`^[UW][A-Z0-9]{2,}$`)
+
+// LoadUserOverrides reads and validates user overrides from a JSON file.
+func LoadUserOverrides(filename string) (*UserOverrides, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var overrides UserOverrides
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&overrides); err != nil {
+		return nil, fmt.Errorf("couldn't parse %s: %w", filename, err)
+	}
+
+	if err := overrides.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid user overrides in %s: %w", filename, err)
+	}
+	return &overrides, nil
+}
+
+func (o *UserOverrides) Validate() error {
+	seen := map[string]bool{}
+	for login, target := range o.Users {
+		if login == "" {
+			return fmt.Errorf("empty GitHub login for %q", target)
+		}
+		if seen[strings.ToLower(login)] {
+			return fmt.Errorf("user %q: listed more than once", login)
+		}
+		seen[strings.ToLower(login)] = true
+
+		if slackUserID.MatchString(target) {
+			continue
+		}
+		if _, err := mail.ParseAddress(target); err != nil || !strings.Contains(target, "@") {
+			return fmt.Errorf("user %q: %q is neither a Slack user ID nor an email", login, target)
+		}
+	}
+	return nil
+}
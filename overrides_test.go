@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadUserOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.json")
+	_ = os.WriteFile(path, []byte(`{"users": {"alice-bot": "U024BE7LH", "bob": "bob@example.com"}}`), 0600)
+
+	overrides, err := LoadUserOverrides(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if overrides.Users["alice-bot"] != "U024BE7LH" || overrides.Users["bob"] != "bob@example.com" {
+		t.Errorf("unexpected overrides: %v", overrides.Users)
+	}
+}
+
+func TestUserOverridesValidate(t *testing.T) {
+	invalid := map[string]map[string]string{
+		"not a Slack user": {"alice": "alice"},
+		"channel ID":       {"alice": "C024BE91L"},
+		"empty login":      {"": "U024BE7LH"},
+		"listed twice":     {"alice": "U024BE7LH", "Alice": "U024BE7LH"},
+	}
+	for name, users := range invalid {
+		if err := (&UserOverrides{Users: users}).Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
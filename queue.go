@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/bugsnag/bugsnag-go"
+	"github.com/geckoboard/cake-bot/ctx"
+)
+
+var (
+	ErrQueueFull   = errors.New("event queue is full")
+	ErrQueueClosed = errors.New("event queue is closed")
+)
+
+// EventHandler processes a single decoded webhook event.
+type EventHandler func(context.Context) error
+
+type queuedEvent struct {
+	c       context.Context
+	handler EventHandler
+}
+
+// EventQueue decouples receiving webhooks from notifying Slack, so that a slow
+// Slack API doesn't hold up the HTTP response to GitHub.
+type EventQueue struct {
+	concurrency int
+	events      chan queuedEvent
+	wg          sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewEventQueue instantiates a new EventQueue that buffers up to capacity
+// events and processes them with concurrency workers once started.
+func NewEventQueue(concurrency, capacity int) *EventQueue {
+	return &EventQueue{
+		concurrency: concurrency,
+		events:      make(chan queuedEvent, capacity),
+	}
+}
+
+// Start launches the queue workers.
+func (q *EventQueue) Start() {
+	for i := 0; i < q.concurrency; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+}
+
+// Enqueue adds an event to the queue without blocking. It returns ErrQueueFull
+// if the queue is at capacity, or ErrQueueClosed if it is being drained.
+func (q *EventQueue) Enqueue(c context.Context, handler EventHandler) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	select {
+	case q.events <- queuedEvent{c, handler}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Drain stops accepting new events and waits for the queued ones to be
+// processed, or for c to be done.
+func (q *EventQueue) Drain(c context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.events)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-c.Done():
+		return c.Err()
+	}
+}
+
+func (q *EventQueue) work() {
+	defer q.wg.Done()
+
+	for e := range q.events {
+		q.process(e)
+	}
+}
+
+func (q *EventQueue) process(e queuedEvent) {
+	defer bugsnag.Recover()
+
+	if err := e.handler(e.c); err != nil {
+		ctx.Logger(e.c).Error("at", "event_error", "err", err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+func TestEventQueueDrainProcessesQueuedEvents(t *testing.T) {
+	q := NewEventQueue(2, 10)
+
+	var processed int32
+	for i := 0; i < 10; i++ {
+		err := q.Enqueue(context.Background(), func(context.Context) error {
+			atomic.AddInt32(&processed, 1)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q.Start()
+	if err := q.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if processed != 10 {
+		t.Fatalf("expected 10 events to be processed, got %d", processed)
+	}
+
+	if err := q.Enqueue(context.Background(), func(context.Context) error { return nil }); err != ErrQueueClosed {
+		t.Fatalf("expected ErrQueueClosed after draining, got %v", err)
+	}
+}
+
+func TestEventQueueRejectsEventsWhenFull(t *testing.T) {
+	q := NewEventQueue(1, 1)
+	noop := func(context.Context) error { return nil }
+
+	if err := q.Enqueue(context.Background(), noop); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.Enqueue(context.Background(), noop); err != ErrQueueFull {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestGitHubWebhookWithEventQueue(t *testing.T) {
+	outcome := &fakeNotifier{}
+	validator := &fakeWebhookValidator{}
+	queue := NewEventQueue(1, 10)
+	queue.Start()
+
+	s := httptest.NewServer(NewServer(outcome, validator, validator, WithEventQueue(queue)))
+	defer s.Close()
+
+	file, err := os.Open("./example-webhooks/pull_request_review_approved.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("POST", s.URL+"/github", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("X-Github-Event", "pull_request_review")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("expected status code to be 202, got %d", resp.StatusCode)
+	}
+
+	if err := queue.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(outcome.notifications) != 1 || outcome.notifications[0].action != "approved" {
+		t.Fatalf("expected 1 approved notification, instead got: %#v", outcome.notifications)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/geckoboard/cake-bot/github"
+	"github.com/geckoboard/cake-bot/slack"
+	slackapi "github.com/slack-go/slack"
+)
+
+// ReviewerAPI changes who is asked to review pull requests on GitHub.
+// *github.Client implements it.
+type ReviewerAPI interface {
+	PullRequest(c context.Context, repo string, number int) (*github.PullRequest, error)
+	RequestReviewers(c context.Context, repo string, number int, logins []string) error
+	RemoveRequestedReviewers(c context.Context, repo string, number int, logins []string) error
+}
+
+// ReassignNotifier lets people on Slack choose another reviewer.
+type ReassignNotifier interface {
+	// IsAvailable reports whether the user can be asked for a review now.
+	IsAvailable(*github.User) bool
+	// SuggestReviewer offers the suggestion in reply to the message the
+	// payload was sent for.
+	SuggestReviewer(context.Context, *slackapi.InteractionCallback, ReviewerSuggestion) error
+	RespondToSlackAction(context.Context, *slackapi.InteractionCallback, string) error
+	// RespondEphemerally replies to the user who sent the payload only.
+	RespondEphemerally(context.Context, *slackapi.InteractionCallback, string) error
+}
+
+// ReviewerSuggestion proposes asking To to review the pull request instead of
+// From. To is nil if nobody else is available.
+type ReviewerSuggestion struct {
+	Repository  *github.Repository
+	PullRequest *github.PullRequest
+	From        *github.User
+	To          *github.User
+}
+
+// Reassigner suggests another reviewer from the repository's pool when a
+// reviewer is unable to review a pull request, and asks them on GitHub once
+// the suggestion is confirmed.
+type Reassigner struct {
+	api      ReviewerAPI
+	pools    *ReviewerPools
+	notifier ReassignNotifier
+
+	// githubLogin returns the GitHub login of the Slack user with the ID.
+	githubLogin func(slackID string) string
+}
+
+func NewReassigner(api ReviewerAPI, pools *ReviewerPools, notifier ReassignNotifier) *Reassigner {
+	return &Reassigner{
+		api:         api,
+		pools:       pools,
+		notifier:    notifier,
+		githubLogin: slack.Users.FindGitHubUsername,
+	}
+}
+
+// Suggest offers another reviewer for the review request that the payload's
+// "Please reassign" button was clicked on.
+func (r *Reassigner) Suggest(c context.Context, payload *slackapi.InteractionCallback) error {
+	if len(payload.ActionCallback.BlockActions) == 0 {
+		return nil
+	}
+
+	key, declined, ok := parseReviewerResponseBlockID(payload.ActionCallback.BlockActions[0].BlockID)
+	if !ok || strings.HasPrefix(declined, "@") {
+		// Older messages don't say who the request was for, and teams
+		// can reassign among themselves.
+		return nil
+	}
+
+	pr, err := r.api.PullRequest(c, key.Repo, key.Number)
+	if err != nil {
+		return err
+	}
+
+	suggestion := ReviewerSuggestion{
+		Repository:  repositoryFromKey(key),
+		PullRequest: pr,
+		From:        &github.User{Login: declined},
+	}
+	if login := r.pick(key.Repo, pr, declined); login != "" {
+		suggestion.To = &github.User{Login: login}
+	}
+	return r.notifier.SuggestReviewer(c, payload, suggestion)
+}
+
+// pick returns the first available reviewer in the pool after the one that
+// declined, so that the same person isn't always asked first.
+func (r *Reassigner) pick(repo string, pr *github.PullRequest, declined string) string {
+	pool := r.pools.Pool(repo)
+	start := slices.IndexFunc(pool, func(login string) bool { return strings.EqualFold(login, declined) })
+
+	for i := 1; i <= len(pool); i++ {
+		login := pool[(start+i+len(pool))%len(pool)]
+
+		switch {
+		case strings.EqualFold(login, declined):
+		case pr.User != nil && strings.EqualFold(login, pr.User.Login):
+		case slices.ContainsFunc(pr.RequestedReviewers, func(u *github.User) bool { return strings.EqualFold(u.Login, login) }):
+		case !r.notifier.IsAvailable(&github.User{Login: login}):
+		default:
+			return login
+		}
+	}
+	return ""
+}
+
+// Confirm asks the suggested reviewer to review the pull request on GitHub,
+// and withdraws the request to the reviewer that declined. GitHub's webhooks
+// then notify everyone as usual. Only the reviewer that declined and the
+// author of the pull request may confirm.
+func (r *Reassigner) Confirm(c context.Context, payload *slackapi.InteractionCallback) error {
+	if len(payload.ActionCallback.BlockActions) == 0 {
+		return nil
+	}
+
+	key, from, to, ok := parseReassignBlockID(payload.ActionCallback.BlockActions[0].BlockID)
+	if !ok {
+		return fmt.Errorf("invalid reassign block ID %q", payload.ActionCallback.BlockActions[0].BlockID)
+	}
+
+	allowed, err := r.mayReassign(c, key, from, r.githubLogin(payload.User.ID))
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return r.notifier.RespondEphemerally(c, payload, fmt.Sprintf(
+			"Only %s or the author of the pull request can ask someone else to review it",
+			buildUserName(&github.User{Login: from}),
+		))
+	}
+
+	// Ask the new reviewer first, so that the pull request isn't left
+	// without one if it fails.
+	if err := r.api.RequestReviewers(c, key.Repo, key.Number, []string{to}); err != nil {
+		_ = r.notifier.RespondToSlackAction(c, payload, fmt.Sprintf(":warning: Couldn't ask %s to review: %v", buildUserName(&github.User{Login: to}), err))
+		return err
+	}
+	if err := r.api.RemoveRequestedReviewers(c, key.Repo, key.Number, []string{from}); err != nil {
+		return err
+	}
+
+	response := fmt.Sprintf(
+		"%s asked %s to review instead of %s",
+		payload.User.Name, buildUserName(&github.User{Login: to}), buildUserName(&github.User{Login: from}),
+	)
+	return r.notifier.RespondToSlackAction(c, payload, response)
+}
+
+// mayReassign reports whether the GitHub user may ask someone else to review
+// the pull request instead of from.
+func (r *Reassigner) mayReassign(c context.Context, key PullRequestKey, from, login string) (bool, error) {
+	if login == "" {
+		return false, nil
+	}
+	if strings.EqualFold(login, from) {
+		return true, nil
+	}
+
+	pr, err := r.api.PullRequest(c, key.Repo, key.Number)
+	if err != nil {
+		return false, err
+	}
+	return pr.User != nil && strings.EqualFold(pr.User.Login, login), nil
+}
+
+// repositoryFromKey returns the repository fields that are known from the
+// key.
+func repositoryFromKey(key PullRequestKey) *github.Repository {
+	name := key.Repo
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return &github.Repository{Name: name, FullName: key.Repo}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/geckoboard/cake-bot/github"
+	slackapi "github.com/slack-go/slack"
+)
+
+// fakeReviewerAPI stands in for the GitHub API.
+type fakeReviewerAPI struct {
+	pr         *github.PullRequest
+	files      []string
+	requestErr error
+
+	requested []string
+	removed   []string
+}
+
+func (f *fakeReviewerAPI) PullRequest(_ context.Context, _ string, _ int) (*github.PullRequest, error) {
+	return f.pr, nil
+}
+
+func (f *fakeReviewerAPI) PullRequestFiles(_ context.Context, _ string, _ int) ([]string, error) {
+	return f.files, nil
+}
+
+func (f *fakeReviewerAPI) RequestReviewers(_ context.Context, _ string, _ int, logins []string) error {
+	if f.requestErr != nil {
+		return f.requestErr
+	}
+	f.requested = append(f.requested, logins...)
+	return nil
+}
+
+func (f *fakeReviewerAPI) RemoveRequestedReviewers(_ context.Context, _ string, _ int, logins []string) error {
+	f.removed = append(f.removed, logins...)
+	return nil
+}
+
+type fakeReassignNotifier struct {
+	away        []string
+	suggestions []ReviewerSuggestion
+	suggested   [][]*github.User
+	responses   []string
+	ephemeral   []string
+}
+
+func (f *fakeReassignNotifier) IsAvailable(user *github.User) bool {
+	for _, login := range f.away {
+		if login == user.Login {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fakeReassignNotifier) SuggestReviewer(_ context.Context, _ *slackapi.InteractionCallback, suggestion ReviewerSuggestion) error {
+	f.suggestions = append(f.suggestions, suggestion)
+	return nil
+}
+
+func (f *fakeReassignNotifier) SuggestReviewers(_ context.Context, _ *github.Repository, _ *github.PullRequest, reviewers []*github.User) error {
+	f.suggested = append(f.suggested, reviewers)
+	return nil
+}
+
+func (f *fakeReassignNotifier) RespondToSlackAction(_ context.Context, _ *slackapi.InteractionCallback, response string) error {
+	f.responses = append(f.responses, response)
+	return nil
+}
+
+func (f *fakeReassignNotifier) RespondEphemerally(_ context.Context, _ *slackapi.InteractionCallback, response string) error {
+	f.ephemeral = append(f.ephemeral, response)
+	return nil
+}
+
+func newInteraction(blockID, value string) *slackapi.InteractionCallback {
+	payload := &slackapi.InteractionCallback{}
+	payload.User.Name = "clicker"
+	payload.ActionCallback.BlockActions = []*slackapi.BlockAction{{BlockID: blockID, Value: value}}
+	return payload
+}
+
+func TestReassignerSuggest(t *testing.T) {
+	pools := &ReviewerPools{Pools: []ReviewerPool{
+		{Repositories: []string{"geckoboard/*"}, Reviewers: []string{"author", "away", "reviewer", "asked", "free", "later"}},
+	}}
+	api := &fakeReviewerAPI{pr: &github.PullRequest{
+		Number:             12,
+		Title:              "Add cake",
+		User:               &github.User{Login: "author"},
+		RequestedReviewers: []*github.User{{Login: "reviewer"}, {Login: "asked"}},
+	}}
+	notifier := &fakeReassignNotifier{away: []string{"away"}}
+	r := NewReassigner(api, pools, notifier)
+
+	key := pullRequestKey(testRepo, testPR)
+	if err := r.Suggest(context.Background(), newInteraction(buildReviewerResponseBlockID(key, "reviewer"), unableToReviewStatusMsg)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(notifier.suggestions) != 1 {
+		t.Fatalf("expected 1 suggestion, got: %#v", notifier.suggestions)
+	}
+	if s := notifier.suggestions[0]; s.To == nil || s.To.Login != "free" || s.From.Login != "reviewer" || s.Repository.Name != "cake-bot" {
+		t.Errorf("unexpected suggestion: %#v", s)
+	}
+
+	// Going round the pool, only the author, away and already asked
+	// reviewers are left.
+	notifier.away = append(notifier.away, "free", "later")
+	if err := r.Suggest(context.Background(), newInteraction(buildReviewerResponseBlockID(key, "reviewer"), unableToReviewStatusMsg)); err != nil {
+		t.Fatal(err)
+	}
+	if s := notifier.suggestions[1]; s.To != nil {
+		t.Errorf("expected nobody to be suggested, got: %#v", s.To)
+	}
+}
+
+func TestReassignerConfirm(t *testing.T) {
+	api := &fakeReviewerAPI{}
+	notifier := &fakeReassignNotifier{}
+	r := NewReassigner(api, &ReviewerPools{}, notifier)
+	r.githubLogin = func(string) string { return "reviewer" }
+
+	key := pullRequestKey(testRepo, testPR)
+	if err := r.Confirm(context.Background(), newInteraction(buildReassignBlockID(key, "reviewer", "free"), reassignStatusMsg)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(api.requested, []string{"free"}) || !reflect.DeepEqual(api.removed, []string{"reviewer"}) {
+		t.Errorf("expected the reviewers to be swapped, requested %v and removed %v", api.requested, api.removed)
+	}
+	if len(notifier.responses) != 1 || notifier.responses[0] != "clicker asked free to review instead of reviewer" {
+		t.Errorf("unexpected response: %v", notifier.responses)
+	}
+}
+
+func TestReassignerConfirmKeepsReviewerWhenRequestFails(t *testing.T) {
+	api := &fakeReviewerAPI{requestErr: errors.New("not a collaborator")}
+	notifier := &fakeReassignNotifier{}
+	r := NewReassigner(api, &ReviewerPools{}, notifier)
+	r.githubLogin = func(string) string { return "reviewer" }
+
+	key := pullRequestKey(testRepo, testPR)
+	if err := r.Confirm(context.Background(), newInteraction(buildReassignBlockID(key, "reviewer", "free"), reassignStatusMsg)); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if len(api.removed) != 0 {
+		t.Errorf("expected the original reviewer to be kept, removed: %v", api.removed)
+	}
+	if len(notifier.responses) != 1 {
+		t.Errorf("expected the failure to be reported on Slack, got: %v", notifier.responses)
+	}
+}
+
+func TestReassignerConfirmOnlyByReviewerOrAuthor(t *testing.T) {
+	api := &fakeReviewerAPI{pr: &github.PullRequest{Number: 12, User: &github.User{Login: "Author"}}}
+	notifier := &fakeReassignNotifier{}
+	r := NewReassigner(api, &ReviewerPools{}, notifier)
+
+	key := pullRequestKey(testRepo, testPR)
+	for _, login := range []string{"", "someone"} {
+		r.githubLogin = func(string) string { return login }
+		if err := r.Confirm(context.Background(), newInteraction(buildReassignBlockID(key, "reviewer", "free"), reassignStatusMsg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(api.requested) != 0 || len(api.removed) != 0 {
+		t.Errorf("expected the reviewers to be kept, requested %v and removed %v", api.requested, api.removed)
+	}
+	if len(notifier.ephemeral) != 2 || len(notifier.responses) != 0 {
+		t.Errorf("expected only the clickers to be told, got: %v and %v", notifier.ephemeral, notifier.responses)
+	}
+
+	r.githubLogin = func(string) string { return "author" }
+	if err := r.Confirm(context.Background(), newInteraction(buildReassignBlockID(key, "reviewer", "free"), reassignStatusMsg)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(api.requested, []string{"free"}) || !reflect.DeepEqual(api.removed, []string{"reviewer"}) {
+		t.Errorf("expected the author to swap the reviewers, requested %v and removed %v", api.requested, api.removed)
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/geckoboard/cake-bot/ctx"
+	"github.com/geckoboard/cake-bot/github"
+	"github.com/geckoboard/cake-bot/store"
+	slackapi "github.com/slack-go/slack"
+)
+
+// PendingReview is a review request that the reviewer hasn't acted on yet.
+type PendingReview struct {
+	Repository  *github.Repository  `json:"repository"`
+	PullRequest *github.PullRequest `json:"pull_request"`
+	Reviewer    *github.User        `json:"reviewer"`
+	RequestedAt time.Time           `json:"requested_at"`
+
+	// Response is the button the reviewer clicked on the review request, if
+	// any.
+	Response string `json:"response,omitempty"`
+
+	RemindedAt  time.Time `json:"reminded_at"`
+	EscalatedAt time.Time `json:"escalated_at"`
+}
+
+// Key returns the pull request the review was requested on.
+func (p PendingReview) Key() PullRequestKey {
+	return pullRequestKey(p.Repository, p.PullRequest)
+}
+
+// ReminderStore keeps track of the pending reviews, at most one per reviewer
+// of a pull request.
+type ReminderStore interface {
+	// Get returns the pending review of the pull request by reviewer, or nil
+	// if there isn't one.
+	Get(pr PullRequestKey, reviewer string) (*PendingReview, error)
+	List() ([]PendingReview, error)
+	// Put adds the pending review, replacing any by the same reviewer.
+	Put(review PendingReview) error
+	// Update replaces the pending review, unless it has been removed or
+	// requested again since it was read.
+	Update(review PendingReview) error
+	Remove(pr PullRequestKey, reviewer string) error
+	RemovePullRequest(pr PullRequestKey) error
+}
+
+// StoreReminderStore is a ReminderStore kept in the review requests bucket of
+// a store.Store.
+type StoreReminderStore struct {
+	store store.Store
+}
+
+func NewStoreReminderStore(s store.Store) *StoreReminderStore {
+	return &StoreReminderStore{store: s}
+}
+
+// reviewRequestKey keys pending reviews by pull request, so that the ones of a
+// pull request can be found by prefix.
+func reviewRequestKey(pr PullRequestKey, reviewer string) string {
+	return pr.String() + "|" + strings.ToLower(reviewer)
+}
+
+func (s *StoreReminderStore) Get(pr PullRequestKey, reviewer string) (*PendingReview, error) {
+	var review PendingReview
+	if ok, err := store.GetJSON(s.store, store.ReviewRequests, reviewRequestKey(pr, reviewer), &review); !ok || err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+// List returns the pending reviews, oldest first.
+func (s *StoreReminderStore) List() ([]PendingReview, error) {
+	var reviews []PendingReview
+	err := s.store.Scan(store.ReviewRequests, "", func(_ string, value []byte) error {
+		var review PendingReview
+		if err := json.Unmarshal(value, &review); err != nil {
+			return err
+		}
+		reviews = append(reviews, review)
+		return nil
+	})
+	sort.SliceStable(reviews, func(i, j int) bool {
+		return reviews[i].RequestedAt.Before(reviews[j].RequestedAt)
+	})
+	return reviews, err
+}
+
+func (s *StoreReminderStore) Put(review PendingReview) error {
+	return store.PutJSON(s.store, store.ReviewRequests, reviewRequestKey(review.Key(), review.Reviewer.Login), review)
+}
+
+func (s *StoreReminderStore) Update(review PendingReview) error {
+	var current PendingReview
+	return store.UpdateJSON(s.store, store.ReviewRequests, reviewRequestKey(review.Key(), review.Reviewer.Login), &current, func(exists bool) (bool, error) {
+		if exists && current.RequestedAt.Equal(review.RequestedAt) {
+			current = review
+		}
+		return exists, nil
+	})
+}
+
+func (s *StoreReminderStore) Remove(pr PullRequestKey, reviewer string) error {
+	return s.store.Delete(store.ReviewRequests, reviewRequestKey(pr, reviewer))
+}
+
+func (s *StoreReminderStore) RemovePullRequest(pr PullRequestKey) error {
+	var keys []string
+	err := s.store.Scan(store.ReviewRequests, pr.String()+"|", func(key string, _ []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := s.store.Delete(store.ReviewRequests, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReminderTracker is a Notifier that keeps track of the review requests it
+// notifies about, until the reviewer responds to them or they are no longer
+// needed.
+type ReminderTracker struct {
+	Notifier
+	store ReminderStore
+	now   func() time.Time
+}
+
+func NewReminderTracker(notifier Notifier, store ReminderStore) *ReminderTracker {
+	return &ReminderTracker{Notifier: notifier, store: store, now: time.Now}
+}
+
+// The review request is tracked even if it couldn't be delivered, as the
+// reminder may well be.
+func (t *ReminderTracker) ReviewRequested(c context.Context, repo *github.Repository, pr *github.PullRequest, reviewer *github.User) error {
+	err := t.Notifier.ReviewRequested(c, repo, pr, reviewer)
+	t.track(c, t.store.Put(PendingReview{Repository: repo, PullRequest: pr, Reviewer: reviewer, RequestedAt: t.now()}))
+	return err
+}
+
+func (t *ReminderTracker) Approved(c context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review) error {
+	t.track(c, t.store.Remove(pullRequestKey(repo, pr), review.User.Login))
+	return t.Notifier.Approved(c, repo, pr, review)
+}
+
+func (t *ReminderTracker) ChangesRequested(c context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review) error {
+	t.track(c, t.store.Remove(pullRequestKey(repo, pr), review.User.Login))
+	return t.Notifier.ChangesRequested(c, repo, pr, review)
+}
+
+func (t *ReminderTracker) Commented(c context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review) error {
+	t.track(c, t.store.Remove(pullRequestKey(repo, pr), review.User.Login))
+	return t.Notifier.Commented(c, repo, pr, review)
+}
+
+func (t *ReminderTracker) ReviewRequestRemoved(c context.Context, repo *github.Repository, pr *github.PullRequest, reviewer *github.User, sender *github.User) error {
+	t.track(c, t.store.Remove(pullRequestKey(repo, pr), reviewer.Login))
+	return t.Notifier.ReviewRequestRemoved(c, repo, pr, reviewer, sender)
+}
+
+func (t *ReminderTracker) Merged(c context.Context, repo *github.Repository, pr *github.PullRequest, mergedBy *github.User) error {
+	t.track(c, t.store.RemovePullRequest(pullRequestKey(repo, pr)))
+	return t.Notifier.Merged(c, repo, pr, mergedBy)
+}
+
+func (t *ReminderTracker) Closed(c context.Context, repo *github.Repository, pr *github.PullRequest, closedBy *github.User) error {
+	t.track(c, t.store.RemovePullRequest(pullRequestKey(repo, pr)))
+	return t.Notifier.Closed(c, repo, pr, closedBy)
+}
+
+// RespondToSlackAction records the reviewer's response to a review request, so
+// that they are no longer reminded about it.
+func (t *ReminderTracker) RespondToSlackAction(c context.Context, payload *slackapi.InteractionCallback, response string) error {
+	if actions := payload.ActionCallback.BlockActions; len(actions) > 0 {
+		if pr, reviewer, ok := parseReviewerResponseBlockID(actions[0].BlockID); ok {
+			t.track(c, t.respond(pr, reviewer, actions[0].Value))
+		}
+	}
+	return t.Notifier.RespondToSlackAction(c, payload, response)
+}
+
+func (t *ReminderTracker) respond(pr PullRequestKey, reviewer, response string) error {
+	pending, err := t.store.Get(pr, reviewer)
+	if err != nil || pending == nil {
+		return err
+	}
+
+	pending.Response = response
+	return t.store.Put(*pending)
+}
+
+func (t *ReminderTracker) track(c context.Context, err error) {
+	if err != nil {
+		ctx.Logger(c).Error("at", "reminder_store_error", "err", err)
+	}
+}
+
+// ReminderNotifier nags about pending reviews.
+type ReminderNotifier interface {
+	// RemindReviewer pings the reviewer again, or returns
+	// ErrReviewerOffline if it should be tried again later.
+	RemindReviewer(context.Context, PendingReview) error
+	// EscalateReview lets the pull request's channels know that the review
+	// is overdue.
+	EscalateReview(context.Context, PendingReview) error
+}
+
+// ReminderPolicy decides how long a review request can go without a response
+// before the reviewer is reminded, and before it is escalated. A zero duration
+// disables that step.
+type ReminderPolicy struct {
+	RemindAfter   time.Duration
+	EscalateAfter time.Duration
+}
+
+var DefaultReminderPolicy = ReminderPolicy{
+	RemindAfter:   24 * time.Hour,
+	EscalateAfter: 48 * time.Hour,
+}
+
+// ReminderScheduler periodically reminds reviewers about the review requests
+// they haven't responded to.
+type ReminderScheduler struct {
+	store    ReminderStore
+	notifier ReminderNotifier
+	policy   ReminderPolicy
+	now      func() time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewReminderScheduler(store ReminderStore, notifier ReminderNotifier, policy ReminderPolicy) *ReminderScheduler {
+	return &ReminderScheduler{
+		store:    store,
+		notifier: notifier,
+		policy:   policy,
+		now:      time.Now,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start checks for overdue reviews every interval until Stop is called.
+func (s *ReminderScheduler) Start(interval time.Duration) {
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		c := ctx.WithLogger(context.Background(), logger)
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Check(c); err != nil {
+					ctx.Logger(c).Error("at", "reminder_error", "err", err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop waits for the check in progress, if any, and stops checking.
+func (s *ReminderScheduler) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+// Check reminds or escalates every pending review that is due. A reminder that
+// fails is tried again on the next check.
+func (s *ReminderScheduler) Check(c context.Context) error {
+	reviews, err := s.store.List()
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+
+	var errs []error
+	for _, review := range reviews {
+		if review.Response != "" {
+			continue
+		}
+
+		age := now.Sub(review.RequestedAt)
+
+		switch {
+		case s.policy.EscalateAfter > 0 && review.EscalatedAt.IsZero() && age >= s.policy.EscalateAfter:
+			if err := s.notifier.EscalateReview(c, review); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			review.EscalatedAt = now
+		case s.policy.RemindAfter > 0 && review.RemindedAt.IsZero() && review.EscalatedAt.IsZero() && age >= s.policy.RemindAfter:
+			err := s.notifier.RemindReviewer(c, review)
+			if errors.Is(err, ErrReviewerOffline) {
+				continue
+			}
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			review.RemindedAt = now
+		default:
+			continue
+		}
+
+		if err := s.store.Update(review); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
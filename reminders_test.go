@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/geckoboard/cake-bot/github"
+	"github.com/geckoboard/cake-bot/store"
+	slackapi "github.com/slack-go/slack"
+)
+
+type fakeReminderNotifier struct {
+	offline   bool
+	reminded  []PendingReview
+	escalated []PendingReview
+}
+
+func (f *fakeReminderNotifier) RemindReviewer(_ context.Context, review PendingReview) error {
+	if f.offline {
+		return ErrReviewerOffline
+	}
+	f.reminded = append(f.reminded, review)
+	return nil
+}
+
+func (f *fakeReminderNotifier) EscalateReview(_ context.Context, review PendingReview) error {
+	f.escalated = append(f.escalated, review)
+	return nil
+}
+
+func TestReminderSchedulerRemindsThenEscalates(t *testing.T) {
+	store := NewStoreReminderStore(store.NewMemory())
+	notifier := &fakeReminderNotifier{}
+	s := NewReminderScheduler(store, notifier, ReminderPolicy{RemindAfter: time.Hour, EscalateAfter: 3 * time.Hour})
+
+	requestedAt := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	now := requestedAt
+	s.now = func() time.Time { return now }
+
+	_ = store.Put(PendingReview{Repository: testRepo, PullRequest: testPR, Reviewer: testReview.User, RequestedAt: requestedAt})
+	_ = store.Put(PendingReview{Repository: testRepo, PullRequest: testPR, Reviewer: &github.User{Login: "busy"}, RequestedAt: requestedAt, Response: unableToReviewStatusMsg})
+
+	c := context.Background()
+	check := func(after time.Duration) {
+		t.Helper()
+		now = requestedAt.Add(after)
+		if err := s.Check(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check(30 * time.Minute)
+	if len(notifier.reminded) != 0 || len(notifier.escalated) != 0 {
+		t.Fatalf("expected nothing to be due yet, got: %#v %#v", notifier.reminded, notifier.escalated)
+	}
+
+	check(time.Hour)
+	check(2 * time.Hour)
+	if len(notifier.reminded) != 1 || notifier.reminded[0].Reviewer.Login != "reviewer" {
+		t.Fatalf("expected the reviewer to be reminded once, got: %#v", notifier.reminded)
+	}
+
+	check(3 * time.Hour)
+	check(4 * time.Hour)
+	if len(notifier.escalated) != 1 || notifier.escalated[0].Reviewer.Login != "reviewer" {
+		t.Fatalf("expected the review to be escalated once, got: %#v", notifier.escalated)
+	}
+}
+
+func TestReminderSchedulerHoldsRemindersWhileOffline(t *testing.T) {
+	store := NewStoreReminderStore(store.NewMemory())
+	notifier := &fakeReminderNotifier{offline: true}
+	s := NewReminderScheduler(store, notifier, ReminderPolicy{RemindAfter: time.Hour})
+
+	requestedAt := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return requestedAt.Add(2 * time.Hour) }
+	_ = store.Put(PendingReview{Repository: testRepo, PullRequest: testPR, Reviewer: testReview.User, RequestedAt: requestedAt})
+
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatalf("expected an offline reviewer not to be an error, got: %v", err)
+	}
+
+	notifier.offline = false
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(notifier.reminded) != 1 {
+		t.Fatalf("expected the held reminder to be sent, got: %#v", notifier.reminded)
+	}
+}
+
+func TestReminderTrackerStopsTracking(t *testing.T) {
+	store := NewStoreReminderStore(store.NewMemory())
+	tracker := NewReminderTracker(&fakeNotifier{}, store)
+	c := context.Background()
+	key := pullRequestKey(testRepo, testPR)
+
+	other := &github.User{Login: "other", ID: 4}
+	_ = tracker.ReviewRequested(c, testRepo, testPR, testReview.User)
+	_ = tracker.ReviewRequested(c, testRepo, testPR, other)
+
+	if pending, _ := store.List(); len(pending) != 2 {
+		t.Fatalf("expected 2 pending reviews, got: %#v", pending)
+	}
+
+	_ = tracker.Approved(c, testRepo, testPR, testReview)
+	if pending, _ := store.Get(key, "reviewer"); pending != nil {
+		t.Fatalf("expected the review to no longer be pending, got: %#v", pending)
+	}
+
+	payload := &slackapi.InteractionCallback{}
+	payload.ActionCallback.BlockActions = []*slackapi.BlockAction{
+		{BlockID: buildReviewerResponseBlockID(key, "Other"), Value: reviewingRequestStatusMsg},
+	}
+	_ = tracker.RespondToSlackAction(c, payload, "looking")
+	if pending, _ := store.Get(key, "other"); pending == nil || pending.Response != reviewingRequestStatusMsg {
+		t.Fatalf("expected the response to be recorded, got: %#v", pending)
+	}
+
+	_ = tracker.Merged(c, testRepo, testPR, testPR.User)
+	if pending, _ := store.List(); len(pending) != 0 {
+		t.Fatalf("expected no pending reviews once merged, got: %#v", pending)
+	}
+}
+
+func TestStoreReminderStoreSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cake-bot.db")
+
+	db, err := store.OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewStoreReminderStore(db)
+
+	requestedAt := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	if err := s.Put(PendingReview{Repository: testRepo, PullRequest: testPR, Reviewer: testReview.User, RequestedAt: requestedAt}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = store.OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	pending, err := NewStoreReminderStore(db).Get(pullRequestKey(testRepo, testPR), "reviewer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending == nil || !pending.RequestedAt.Equal(requestedAt) || pending.PullRequest.Title != testPR.Title {
+		t.Fatalf("expected the pending review to be loaded, got: %#v", pending)
+	}
+}
+
+func TestStoreReminderStore(t *testing.T) {
+	s := NewStoreReminderStore(store.NewMemory())
+
+	requestedAt := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	first := PendingReview{Repository: testRepo, PullRequest: testPR, Reviewer: testReview.User, RequestedAt: requestedAt.Add(time.Hour)}
+	second := PendingReview{Repository: testRepo, PullRequest: testPR, Reviewer: &github.User{Login: "Alice"}, RequestedAt: requestedAt}
+	other := PendingReview{Repository: testRepo, PullRequest: &github.PullRequest{Number: 13}, Reviewer: testReview.User, RequestedAt: requestedAt}
+	for _, review := range []PendingReview{first, second, other} {
+		if err := s.Put(review); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pending, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 3 || !pending[2].RequestedAt.Equal(first.RequestedAt) {
+		t.Fatalf("expected the pending reviews oldest first, got: %#v", pending)
+	}
+
+	// Updates only apply to the same request, not to one made since.
+	stale := first
+	stale.RequestedAt = requestedAt
+	stale.Response = "busy"
+	_ = s.Update(stale)
+	first.Response = "on_it"
+	_ = s.Update(first)
+	if review, _ := s.Get(first.Key(), "REVIEWER"); review == nil || review.Response != "on_it" {
+		t.Fatalf("expected the pending review to be updated, got: %#v", review)
+	}
+
+	_ = s.Remove(second.Key(), "alice")
+	if review, _ := s.Get(second.Key(), "alice"); review != nil {
+		t.Fatalf("expected the pending review to be removed, got: %#v", review)
+	}
+
+	_ = s.RemovePullRequest(first.Key())
+	if pending, _ := s.List(); len(pending) != 1 || pending[0].PullRequest.Number != 13 {
+		t.Fatalf("expected only the other pull request to be left, got: %#v", pending)
+	}
+}
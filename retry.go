@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/geckoboard/cake-bot/ctx"
+	"github.com/geckoboard/cake-bot/github"
+	slackapi "github.com/slack-go/slack"
+)
+
+// RetryPolicy controls how failed Slack deliveries are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubled on each
+	// subsequent retry up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// RetryingNotifier is a Notifier that retries transient Slack failures, and
+// records notifications it gave up on in a dead-letter log.
+type RetryingNotifier struct {
+	notifier    Notifier
+	policy      RetryPolicy
+	deadLetters DeadLetterLog
+
+	sleep  func(context.Context, time.Duration) error
+	jitter func(time.Duration) time.Duration
+}
+
+// NewRetryingNotifier wraps notifier so that transient failures are retried
+// according to policy.
+func NewRetryingNotifier(notifier Notifier, policy RetryPolicy, deadLetters DeadLetterLog) *RetryingNotifier {
+	return &RetryingNotifier{
+		notifier:    notifier,
+		policy:      policy,
+		deadLetters: deadLetters,
+		sleep:       sleepContext,
+		jitter:      fullJitter,
+	}
+}
+
+func (n *RetryingNotifier) ReviewRequested(c context.Context, repo *github.Repository, pr *github.PullRequest, reviewer *github.User) error {
+	return n.retry(c, DeadLetter{Method: "ReviewRequested", Repository: repo, PullRequest: pr, User: reviewer}, func() error {
+		return n.notifier.ReviewRequested(c, repo, pr, reviewer)
+	})
+}
+
+func (n *RetryingNotifier) TeamReviewRequested(c context.Context, repo *github.Repository, pr *github.PullRequest, team *github.Team) error {
+	return n.retry(c, DeadLetter{Method: "TeamReviewRequested", Repository: repo, PullRequest: pr, Team: team}, func() error {
+		return n.notifier.TeamReviewRequested(c, repo, pr, team)
+	})
+}
+
+func (n *RetryingNotifier) Approved(c context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review) error {
+	return n.retry(c, DeadLetter{Method: "Approved", Repository: repo, PullRequest: pr, Review: review}, func() error {
+		return n.notifier.Approved(c, repo, pr, review)
+	})
+}
+
+func (n *RetryingNotifier) ChangesRequested(c context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review) error {
+	return n.retry(c, DeadLetter{Method: "ChangesRequested", Repository: repo, PullRequest: pr, Review: review}, func() error {
+		return n.notifier.ChangesRequested(c, repo, pr, review)
+	})
+}
+
+func (n *RetryingNotifier) Commented(c context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review) error {
+	return n.retry(c, DeadLetter{Method: "Commented", Repository: repo, PullRequest: pr, Review: review}, func() error {
+		return n.notifier.Commented(c, repo, pr, review)
+	})
+}
+
+func (n *RetryingNotifier) ReviewEdited(c context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review) error {
+	return n.retry(c, DeadLetter{Method: "ReviewEdited", Repository: repo, PullRequest: pr, Review: review}, func() error {
+		return n.notifier.ReviewEdited(c, repo, pr, review)
+	})
+}
+
+func (n *RetryingNotifier) ReviewDismissed(c context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review, dismissedBy *github.User) error {
+	return n.retry(c, DeadLetter{Method: "ReviewDismissed", Repository: repo, PullRequest: pr, Review: review, Sender: dismissedBy}, func() error {
+		return n.notifier.ReviewDismissed(c, repo, pr, review, dismissedBy)
+	})
+}
+
+func (n *RetryingNotifier) ReviewRequestRemoved(c context.Context, repo *github.Repository, pr *github.PullRequest, reviewer *github.User, sender *github.User) error {
+	return n.retry(c, DeadLetter{Method: "ReviewRequestRemoved", Repository: repo, PullRequest: pr, User: reviewer, Sender: sender}, func() error {
+		return n.notifier.ReviewRequestRemoved(c, repo, pr, reviewer, sender)
+	})
+}
+
+func (n *RetryingNotifier) Merged(c context.Context, repo *github.Repository, pr *github.PullRequest, mergedBy *github.User) error {
+	return n.retry(c, DeadLetter{Method: "Merged", Repository: repo, PullRequest: pr, Sender: mergedBy}, func() error {
+		return n.notifier.Merged(c, repo, pr, mergedBy)
+	})
+}
+
+func (n *RetryingNotifier) Closed(c context.Context, repo *github.Repository, pr *github.PullRequest, closedBy *github.User) error {
+	return n.retry(c, DeadLetter{Method: "Closed", Repository: repo, PullRequest: pr, Sender: closedBy}, func() error {
+		return n.notifier.Closed(c, repo, pr, closedBy)
+	})
+}
+
+func (n *RetryingNotifier) CommentsPosted(c context.Context, repo *github.Repository, pr *github.PullRequest, comments []*github.Comment) error {
+	return n.retry(c, DeadLetter{Method: "CommentsPosted", Repository: repo, PullRequest: pr, Comments: comments}, func() error {
+		return n.notifier.CommentsPosted(c, repo, pr, comments)
+	})
+}
+
+// RespondToSlackAction is retried, but isn't dead-lettered: by the time it
+// could be replayed the person who clicked the button has moved on.
+func (n *RetryingNotifier) RespondToSlackAction(c context.Context, payload *slackapi.InteractionCallback, response string) error {
+	return n.retry(c, DeadLetter{}, func() error {
+		return n.notifier.RespondToSlackAction(c, payload, response)
+	})
+}
+
+func (n *RetryingNotifier) retry(c context.Context, letter DeadLetter, fn func() error) error {
+	l := ctx.Logger(c)
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+
+		if !isRetryable(err) || attempt >= n.policy.MaxAttempts {
+			break
+		}
+
+		delay := n.delay(attempt, err)
+		l.Warn("at", "notify_retry", "attempt", attempt, "delay", delay, "err", err)
+
+		if sleepErr := n.sleep(c, delay); sleepErr != nil {
+			break
+		}
+	}
+
+	if letter.Method != "" && n.deadLetters != nil {
+		letter.Time = time.Now()
+		letter.Err = err.Error()
+
+		if dlErr := n.deadLetters.Add(letter); dlErr != nil {
+			l.Error("at", "dead_letter_error", "err", dlErr)
+		} else {
+			l.Error("at", "dead_letter", "method", letter.Method, "err", err)
+		}
+	}
+	return err
+}
+
+// delay returns how long to wait before the next attempt. Slack's Retry-After
+// wins over our own exponential backoff.
+func (n *RetryingNotifier) delay(attempt int, err error) time.Duration {
+	var rateLimited *slackapi.RateLimitedError
+	if errors.As(err, &rateLimited) && rateLimited.RetryAfter > 0 {
+		return rateLimited.RetryAfter
+	}
+
+	backoff := n.policy.BaseDelay << (attempt - 1)
+	if backoff <= 0 || backoff > n.policy.MaxDelay {
+		backoff = n.policy.MaxDelay
+	}
+	return n.jitter(backoff)
+}
+
+// isRetryable reports whether err is a transient Slack failure: an HTTP 5xx or
+// 429, or a "ratelimited" API error.
+func isRetryable(err error) bool {
+	var retryable interface{ Retryable() bool }
+	if errors.As(err, &retryable) {
+		return retryable.Retryable()
+	}
+
+	var slackErr slackapi.SlackErrorResponse
+	if errors.As(err, &slackErr) {
+		return slackErr.Err == "ratelimited" || slackErr.Err == "internal_error"
+	}
+
+	return false
+}
+
+func fullJitter(d time.Duration) time.Duration {
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+func sleepContext(c context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-c.Done():
+		return c.Err()
+	}
+}
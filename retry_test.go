@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/geckoboard/cake-bot/github"
+	"github.com/geckoboard/cake-bot/store"
+	"github.com/slack-go/slack"
+)
+
+// flakyNotifier fails with the queued errors before delegating to a
+// fakeNotifier.
+type flakyNotifier struct {
+	fakeNotifier
+	errs []error
+}
+
+func (f *flakyNotifier) Approved(c context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review) error {
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return err
+	}
+	return f.fakeNotifier.Approved(c, repo, pr, review)
+}
+
+func newTestRetryingNotifier(t *testing.T, notifier Notifier) (*RetryingNotifier, *StoreDeadLetterLog, *[]time.Duration) {
+	deadLetters := NewStoreDeadLetterLog(store.NewMemory())
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	var sleeps []time.Duration
+	r := NewRetryingNotifier(notifier, policy, deadLetters)
+	r.jitter = func(d time.Duration) time.Duration { return d }
+	r.sleep = func(_ context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+	return r, deadLetters, &sleeps
+}
+
+var (
+	testRepo   = &github.Repository{Name: "cake-bot", FullName: "geckoboard/cake-bot"}
+	testPR     = &github.PullRequest{Number: 12, Title: "Add cake", User: &github.User{Login: "author", ID: 1}}
+	testReview = &github.Review{ID: 3, User: &github.User{Login: "reviewer", ID: 2}, State: "approved"}
+)
+
+func TestRetryingNotifierRetriesTransientErrors(t *testing.T) {
+	flaky := &flakyNotifier{errs: []error{
+		slack.StatusCodeError{Code: 503, Status: "503 Service Unavailable"},
+		&slack.RateLimitedError{RetryAfter: 7 * time.Second},
+	}}
+	r, deadLetters, sleeps := newTestRetryingNotifier(t, flaky)
+
+	if err := r.Approved(context.Background(), testRepo, testPR, testReview); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(flaky.notifications) != 1 {
+		t.Fatalf("expected notification to eventually be sent, got: %#v", flaky.notifications)
+	}
+
+	// Exponential backoff first, then Slack's Retry-After.
+	if len(*sleeps) != 2 || (*sleeps)[0] != time.Second || (*sleeps)[1] != 7*time.Second {
+		t.Fatalf("unexpected delays between attempts: %v", *sleeps)
+	}
+
+	if letters, _ := deadLetters.List(); len(letters) != 0 {
+		t.Fatalf("expected no dead letters, got: %#v", letters)
+	}
+}
+
+func TestRetryingNotifierDoesNotRetryPermanentErrors(t *testing.T) {
+	flaky := &flakyNotifier{errs: []error{slack.SlackErrorResponse{Err: "channel_not_found"}}}
+	r, deadLetters, sleeps := newTestRetryingNotifier(t, flaky)
+
+	if err := r.Approved(context.Background(), testRepo, testPR, testReview); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if len(*sleeps) != 0 {
+		t.Fatalf("expected no retries, got delays: %v", *sleeps)
+	}
+
+	if letters, _ := deadLetters.List(); len(letters) != 1 {
+		t.Fatalf("expected 1 dead letter, got: %#v", letters)
+	}
+}
+
+func TestRetryingNotifierDeadLettersAndReplays(t *testing.T) {
+	transient := slack.SlackErrorResponse{Err: "ratelimited"}
+	flaky := &flakyNotifier{errs: []error{transient, transient, transient}}
+	r, deadLetters, sleeps := newTestRetryingNotifier(t, flaky)
+
+	var slackErr slack.SlackErrorResponse
+	if err := r.Approved(context.Background(), testRepo, testPR, testReview); !errors.As(err, &slackErr) || slackErr.Err != "ratelimited" {
+		t.Fatalf("expected the last error to be returned, got: %v", err)
+	}
+
+	if len(*sleeps) != 2 {
+		t.Fatalf("expected 2 retries, got delays: %v", *sleeps)
+	}
+
+	letters, err := deadLetters.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(letters) != 1 || letters[0].Method != "Approved" || letters[0].PullRequest.Number != 12 {
+		t.Fatalf("unexpected dead letters: %#v", letters)
+	}
+
+	replayed, err := ReplayDeadLetters(context.Background(), deadLetters, flaky)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if replayed != 1 || len(flaky.notifications) != 1 || flaky.notifications[0].reviewer.Login != "reviewer" {
+		t.Fatalf("expected dead letter to be replayed, got: %#v", flaky.notifications)
+	}
+
+	if letters, _ := deadLetters.List(); len(letters) != 0 {
+		t.Fatalf("expected replayed dead letters to be removed, got: %#v", letters)
+	}
+}
+
+// addingNotifier adds a dead letter whenever it is asked to notify, as the
+// server may while dead letters are being replayed.
+type addingNotifier struct {
+	fakeNotifier
+	deadLetters DeadLetterLog
+}
+
+func (a *addingNotifier) Approved(c context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review) error {
+	if err := a.deadLetters.Add(DeadLetter{Method: "Closed", Repository: repo, PullRequest: pr}); err != nil {
+		return err
+	}
+	return a.fakeNotifier.Approved(c, repo, pr, review)
+}
+
+func TestReplayDeadLettersKeepsLettersAddedMeanwhile(t *testing.T) {
+	deadLetters := NewStoreDeadLetterLog(store.NewMemory())
+	_ = deadLetters.Add(DeadLetter{Method: "Approved", Repository: testRepo, PullRequest: testPR, Review: testReview})
+	_ = deadLetters.Add(DeadLetter{Method: "Unknown"})
+
+	replayed, err := ReplayDeadLetters(context.Background(), deadLetters, &addingNotifier{deadLetters: deadLetters})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed != 1 {
+		t.Errorf("expected 1 dead letter to be replayed, got: %d", replayed)
+	}
+
+	letters, err := deadLetters.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 2 || letters[0].Method != "Unknown" || letters[0].Err == "" || letters[1].Method != "Closed" {
+		t.Fatalf("expected the failed and the added dead letters to be kept, got: %#v", letters)
+	}
+}
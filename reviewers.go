@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// ReviewerPools lists who can review the pull requests of each repository.
+type ReviewerPools struct {
+	Pools []ReviewerPool `json:"pools"`
+}
+
+// ReviewerPool is the GitHub logins of the people who can review pull requests
+// in Repositories, which may be glob patterns such as "geckoboard/api-*".
+type ReviewerPool struct {
+	Repositories []string `json:"repositories"`
+	Reviewers    []string `json:"reviewers"`
+
+	// Owners are asked to review the pull requests that change their paths,
+	// instead of the Reviewers. Like CODEOWNERS, the last matching entry
+	// owns a path.
+	Owners []PathOwners `json:"owners,omitempty"`
+
+	// Strategy picks reviewers to assign automatically, defaulting to
+	// round robin.
+	Strategy AssignStrategy `json:"strategy,omitempty"`
+	// ReviewersPerPullRequest is how many reviewers are assigned
+	// automatically, defaulting to 1.
+	ReviewersPerPullRequest int `json:"reviewers_per_pull_request,omitempty"`
+}
+
+// PathOwners is the GitHub logins of the people who own the paths matching
+// Paths. Patterns work as in CODEOWNERS: "*.go" matches Go files anywhere,
+// "/docs/" everything in the top level docs directory and "apps/web" the web
+// directory inside apps.
+type PathOwners struct {
+	Paths     []string `json:"paths"`
+	Reviewers []string `json:"reviewers"`
+}
+
+// LoadReviewerPools reads and validates reviewer pools from a JSON file.
+func LoadReviewerPools(filename string) (*ReviewerPools, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var pools ReviewerPools
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&pools); err != nil {
+		return nil, fmt.Errorf("couldn't parse %s: %w", filename, err)
+	}
+
+	if err := pools.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid reviewer pools in %s: %w", filename, err)
+	}
+	return &pools, nil
+}
+
+func (p *ReviewerPools) Validate() error {
+	if len(p.Pools) == 0 {
+		return errors.New("no pools")
+	}
+
+	for i, pool := range p.Pools {
+		if len(pool.Repositories) == 0 {
+			return fmt.Errorf("pool %d has no repositories", i)
+		}
+		if len(pool.Reviewers) == 0 {
+			return fmt.Errorf("pool %d has no reviewers", i)
+		}
+
+		for _, pattern := range pool.Repositories {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("pool %d has invalid repository pattern %q", i, pattern)
+			}
+		}
+
+		switch pool.Strategy {
+		case "", AssignRoundRobin, AssignLeastLoaded:
+		default:
+			return fmt.Errorf("pool %d has unknown strategy %q, expected round_robin or least_loaded", i, pool.Strategy)
+		}
+		if pool.ReviewersPerPullRequest < 0 {
+			return fmt.Errorf("pool %d has a negative reviewers_per_pull_request", i)
+		}
+
+		for j, owners := range pool.Owners {
+			if len(owners.Paths) == 0 || len(owners.Reviewers) == 0 {
+				return fmt.Errorf("pool %d owners %d need paths and reviewers", i, j)
+			}
+			for _, pattern := range owners.Paths {
+				if _, err := path.Match(strings.Trim(pattern, "/"), ""); err != nil {
+					return fmt.Errorf("pool %d owners %d have invalid path pattern %q", i, j, pattern)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Find returns the first pool matching the repository, given by its full name,
+// or nil if none do.
+func (p *ReviewerPools) Find(repo string) *ReviewerPool {
+	for i, pool := range p.Pools {
+		for _, pattern := range pool.Repositories {
+			if ok, _ := path.Match(pattern, repo); ok {
+				return &p.Pools[i]
+			}
+		}
+	}
+	return nil
+}
+
+// Pool returns the reviewers of the first pool matching the repository, given
+// by its full name.
+func (p *ReviewerPools) Pool(repo string) []string {
+	if pool := p.Find(repo); pool != nil {
+		return pool.Reviewers
+	}
+	return nil
+}
+
+// OwnersOf returns the owners of the files, in the order they are listed in
+// the pool, or nil if none of the files are owned.
+func (p *ReviewerPool) OwnersOf(files []string) []string {
+	owned := map[string]bool{}
+	for _, file := range files {
+		for i := len(p.Owners) - 1; i >= 0; i-- {
+			if p.Owners[i].owns(file) {
+				for _, login := range p.Owners[i].Reviewers {
+					owned[strings.ToLower(login)] = true
+				}
+				break
+			}
+		}
+	}
+
+	var owners []string
+	for _, o := range p.Owners {
+		for _, login := range o.Reviewers {
+			if owned[strings.ToLower(login)] {
+				owners = append(owners, login)
+				delete(owned, strings.ToLower(login))
+			}
+		}
+	}
+	return owners
+}
+
+func (o PathOwners) owns(file string) bool {
+	for _, pattern := range o.Paths {
+		if matchPathPattern(pattern, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathPattern reports whether the CODEOWNERS style pattern matches the
+// file or one of the directories it is in. Patterns starting with or
+// containing a slash are relative to the repository root, others match at any
+// depth, and patterns ending with a slash only match directories.
+func matchPathPattern(pattern, file string) bool {
+	dirOnly := strings.HasSuffix(pattern, "/")
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.Trim(pattern, "/")
+
+	parts := strings.Split(file, "/")
+	for start := range parts {
+		if anchored && start > 0 {
+			break
+		}
+		for end := start + 1; end <= len(parts); end++ {
+			if dirOnly && end == len(parts) {
+				continue
+			}
+			if ok, _ := path.Match(pattern, strings.Join(parts[start:end], "/")); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchPathPattern(t *testing.T) {
+	cases := []struct {
+		pattern, file string
+		want          bool
+	}{
+		{"*", "main.go", true},
+		{"*.js", "web/src/app.js", true},
+		{"*.js", "main.go", false},
+		{"/docs/", "docs/index.md", true},
+		{"/docs/", "web/docs/index.md", false},
+		{"docs/", "web/docs/index.md", true},
+		{"docs/", "docs", false},
+		{"apps/web", "apps/web/index.js", true},
+		{"apps/web", "other/apps/web/index.js", false},
+		{"Makefile", "tools/Makefile", true},
+	}
+
+	for _, c := range cases {
+		if got := matchPathPattern(c.pattern, c.file); got != c.want {
+			t.Errorf("matchPathPattern(%q, %q) = %v, want %v", c.pattern, c.file, got, c.want)
+		}
+	}
+}
+
+func TestReviewerPoolOwnersOf(t *testing.T) {
+	pool := ReviewerPool{Owners: []PathOwners{
+		{Paths: []string{"*"}, Reviewers: []string{"everyone"}},
+		{Paths: []string{"*.js"}, Reviewers: []string{"alice", "bob"}},
+		{Paths: []string{"/db/"}, Reviewers: []string{"Bob", "carol"}},
+	}}
+
+	if got, want := pool.OwnersOf([]string{"web/app.js", "db/schema.sql"}), []string{"alice", "bob", "carol"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected owners %v, got: %v", want, got)
+	}
+	if got, want := pool.OwnersOf([]string{"README.md"}), []string{"everyone"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected owners %v, got: %v", want, got)
+	}
+}
@@ -2,9 +2,14 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bugsnag/bugsnag-go"
 	"github.com/geckoboard/cake-bot/ctx"
@@ -14,22 +19,114 @@ import (
 	slackapi "github.com/slack-go/slack"
 )
 
-func NewServer(notifier Notifier, validator WebhookValidator) http.Handler {
+// ServerOption configures optional behaviour of the Server.
+type ServerOption func(*Server)
+
+// WithReassigner makes the Server suggest another reviewer when one is unable
+// to review a pull request.
+func WithReassigner(reassigner *Reassigner) ServerOption {
+	return func(s *Server) {
+		s.Reassigner = reassigner
+	}
+}
+
+// WithSlashCommands makes the Server answer the /cake slash command.
+func WithSlashCommands(commands *SlashCommands) ServerOption {
+	return func(s *Server) {
+		s.Commands = commands
+	}
+}
+
+// WithStats serves the review leaderboard at /stats, to requests that have
+// the token as a bearer token. Without a token the leaderboard isn't served at
+// all.
+func WithStats(stats *Stats, token string) ServerOption {
+	return func(s *Server) {
+		if token == "" {
+			return
+		}
+		s.Stats = stats
+		s.StatsToken = token
+	}
+}
+
+// WithAssigner makes the Server pick reviewers for pull requests that are
+// opened without any.
+func WithAssigner(assigner *Assigner) ServerOption {
+	return func(s *Server) {
+		s.Assigner = assigner
+	}
+}
+
+// WithDraftPolicy decides what the Server does with review requests made on
+// draft pull requests. Without it they are deferred until the pull request is
+// ready for review.
+func WithDraftPolicy(policy DraftPolicy) ServerOption {
+	return func(s *Server) {
+		s.Drafts = policy
+	}
+}
+
+// WithDeliveryCache makes the Server ignore GitHub deliveries it has already
+// handled.
+func WithDeliveryCache(cache DeliveryCache) ServerOption {
+	return func(s *Server) {
+		s.Deliveries = cache
+	}
+}
+
+// WithEventQueue makes the Server hand decoded events to the queue and respond
+// with 202 Accepted, instead of notifying Slack within the request.
+func WithEventQueue(queue *EventQueue) ServerOption {
+	return func(s *Server) {
+		s.Queue = queue
+	}
+}
+
+// WithCommentBatcher makes the Server group review comments into batches
+// before notifying Slack about them.
+func WithCommentBatcher(batcher *CommentBatcher) ServerOption {
+	return func(s *Server) {
+		s.Comments = batcher
+	}
+}
+
+func NewServer(notifier Notifier, validator WebhookValidator, slackValidator WebhookValidator, opts ...ServerOption) http.Handler {
 	s := &Server{
-		Notifier:         notifier,
-		WebhookValidator: validator,
+		Notifier:              notifier,
+		WebhookValidator:      validator,
+		SlackRequestValidator: slackValidator,
+		Drafts:                DraftDefer,
+	}
+
+	for _, opt := range opts {
+		opt(s)
 	}
 
 	r := httprouter.New()
 	r.GET("/", s.root)
 	r.POST("/github", s.githubWebhook)
 	r.POST("/slack/interact", s.handleSlackInteractionEvent)
+	r.POST("/slack/command", s.handleSlashCommand)
+	if s.Stats != nil && s.StatsToken != "" {
+		r.GET("/stats", s.stats)
+	}
 	return r
 }
 
 type Server struct {
-	Notifier         Notifier
-	WebhookValidator WebhookValidator
+	Notifier              Notifier
+	WebhookValidator      WebhookValidator
+	SlackRequestValidator WebhookValidator
+	Deliveries            DeliveryCache
+	Queue                 *EventQueue
+	Comments              *CommentBatcher
+	Drafts                DraftPolicy
+	Reassigner            *Reassigner
+	Assigner              *Assigner
+	Stats                 *Stats
+	StatsToken            string
+	Commands              *SlashCommands
 }
 
 func (s *Server) validateSignature(r *http.Request) error {
@@ -41,13 +138,44 @@ func (s *Server) root(w http.ResponseWriter, _ *http.Request, _ httprouter.Param
 	w.WriteHeader(http.StatusFound)
 }
 
+// stats responds with the leaderboard for the last week, or for the number of
+// days given by the days parameter.
+func (s *Server) stats(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.StatsToken)) != 1 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	days := 7
+	if param := r.URL.Query().Get("days"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 {
+			http.Error(w, "days must be a positive number", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	board, err := s.Stats.Leaderboard(time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		logger.Error("endpoint", "stats", "at", "stats_error", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(board)
+}
+
 func (s *Server) githubWebhook(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	event := r.Header.Get("X-GitHub-Event")
+	deliveryID := r.Header.Get("X-GitHub-Delivery")
 
 	l := logger.With(
 		"endpoint", "webhook",
 		"request_id", r.Header.Get("X-Request-ID"),
-		"github_delivery_id", r.Header.Get("X-GitHub-Delivery"),
+		"github_delivery_id", deliveryID,
 		"github_event", event,
 	)
 
@@ -57,54 +185,181 @@ func (s *Server) githubWebhook(w http.ResponseWriter, r *http.Request, _ httprou
 		return
 	}
 
+	if s.isDuplicateDelivery(deliveryID, l) {
+		l.Info("at", "duplicate_delivery")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	defer func() {
+		// GitHub redelivers webhooks we couldn't take, which mustn't be
+		// mistaken for duplicates.
+		if rec.status == http.StatusServiceUnavailable {
+			s.forgetDelivery(deliveryID, l)
+		}
+	}()
+	w = rec
+
 	switch event {
 	case github.PullRequestEvent:
 		s.handlePullRequestEvent(w, r, l)
 	case github.PullRequestReviewEvent:
 		s.handlePullRequestReviewEvent(w, r, l)
+	case github.PullRequestReviewCommentEvent:
+		s.handlePullRequestReviewCommentEvent(w, r, l)
+	case github.IssueCommentEvent:
+		s.handleIssueCommentEvent(w, r, l)
 	default:
 		l.Info("at", "ignore_event")
 		w.WriteHeader(http.StatusOK)
 	}
 }
 
+// isDuplicateDelivery reports whether the GitHub delivery has already been
+// handled. If the cache can't be consulted the delivery is handled anyway, as a
+// duplicate notification is better than a missing one.
+func (s *Server) isDuplicateDelivery(id string, l log.LeveledLogger) bool {
+	if s.Deliveries == nil || id == "" {
+		return false
+	}
+
+	seen, err := s.Deliveries.Seen(id)
+	if err != nil {
+		l.Error("at", "delivery_cache_error", "err", err)
+		return false
+	}
+	return seen
+}
+
+// forgetDelivery drops the GitHub delivery from the cache, so that it is
+// handled when it is redelivered.
+func (s *Server) forgetDelivery(id string, l log.LeveledLogger) {
+	if s.Deliveries == nil || id == "" {
+		return
+	}
+	if err := s.Deliveries.Forget(id); err != nil {
+		l.Error("at", "delivery_cache_error", "err", err)
+	}
+}
+
+// statusRecorder remembers the status code written to the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
 func (s *Server) handleSlackInteractionEvent(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if err := s.SlackRequestValidator.ValidateSignature(r); err != nil {
+		logger.Error("endpoint", "slack_interact", "at", "invalid_signature", "err", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	l := logger.With("endpoint", "slack_interact")
+
 	var payload slackapi.InteractionCallback
-	err := json.Unmarshal([]byte(r.FormValue("payload")), &payload)
-	if err != nil {
-		fmt.Printf("Could not parse action response JSON: %v", err)
+	if err := json.Unmarshal([]byte(r.FormValue("payload")), &payload); err != nil {
+		l.Error("at", "unmarshal_error", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 
 	if len(payload.ActionCallback.BlockActions) == 0 {
-		fmt.Printf("No block actions found in payload")
+		l.Info("at", "no_block_actions")
 		w.WriteHeader(http.StatusNotFound)
+		return
 	}
 	var receivedAction = payload.ActionCallback.BlockActions[0]
 
 	switch receivedAction.Value {
 	case reviewingRequestStatusMsg:
 		err := s.Notifier.RespondToSlackAction(
-			context.Background(),
+			r.Context(),
 			&payload,
 			fmt.Sprintf("%s is looking at the PR\n", payload.User.Name),
 		)
 
 		if err != nil {
-			fmt.Printf("Error updating message: %v\n", err)
+			l.Error("at", "update_message_error", "err", err)
 		}
 
 	case unableToReviewStatusMsg:
 		err := s.Notifier.RespondToSlackAction(
-			context.Background(),
+			r.Context(),
 			&payload,
 			fmt.Sprintf("%s is unable to look at the PR right now, sorry!\n", payload.User.Name),
 		)
 
 		if err != nil {
-			fmt.Printf("Error updating message: %v\n", err)
+			l.Error("at", "update_message_error", "err", err)
+		}
+
+		if s.Reassigner != nil {
+			s.processInteraction(r, "suggest_reviewer", func(c context.Context) error {
+				return s.Reassigner.Suggest(c, &payload)
+			})
+		}
+	case reassignStatusMsg:
+		if s.Reassigner != nil {
+			s.processInteraction(r, "reassign_reviewer", func(c context.Context) error {
+				return s.Reassigner.Confirm(c, &payload)
+			})
 		}
 	default:
-		fmt.Printf("Unknown action value '%s'\n", receivedAction.Value)
+		l.Info("at", "unknown_action", "value", receivedAction.Value)
+	}
+}
+
+func (s *Server) handleSlashCommand(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if err := s.SlackRequestValidator.ValidateSignature(r); err != nil {
+		logger.Error("endpoint", "slack_command", "at", "invalid_signature", "err", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if s.Commands == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	cmd, err := slackapi.SlashCommandParse(r)
+	if err != nil {
+		logger.Error("endpoint", "slack_command", "at", "parse_error", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	l := logger.With("endpoint", "slack_command", "command", cmd.Command, "user", cmd.UserID)
+
+	msg, err := s.Commands.Handle(ctx.WithLogger(r.Context(), l), cmd)
+	if err != nil {
+		l.Error("at", "command_error", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(msg)
+}
+
+// processInteraction handles a Slack interaction in the background, as Slack
+// expects a response within 3 seconds. Without an event queue it is handled
+// within the request instead, and gives up if the request is cancelled.
+func (s *Server) processInteraction(r *http.Request, action string, handler EventHandler) {
+	l := logger.With("endpoint", "slack_interact", "action", action)
+	c := ctx.WithLogger(context.Background(), l)
+	if s.Queue == nil {
+		c = ctx.WithLogger(r.Context(), l)
+	}
+
+	if err := s.process(c, handler); err != nil {
+		l.Error("at", "event_error", "err", err)
 	}
 }
 
@@ -120,17 +375,91 @@ func (s *Server) handlePullRequestEvent(w http.ResponseWriter, r *http.Request,
 
 	l = webhook.EnhanceLogger(l)
 
-	switch webhook.Action {
-	case "review_requested":
-		c := ctx.WithLogger(context.Background(), l)
-		_ = s.Notifier.ReviewRequested(c, webhook.Repository, webhook.PullRequest, webhook.RequestedReviewer)
+	if err := webhook.Validate(); err != nil {
+		l.Error("at", "payload_error", "err", err)
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	switch {
+	case webhook.Action == "review_requested" && webhook.PullRequest.Draft && s.Drafts == DraftSuppress:
+		l.Info("at", "ignore_draft_review_request")
+		w.WriteHeader(http.StatusOK)
+	case webhook.Action == "review_requested" && webhook.PullRequest.Draft && s.Drafts == DraftDefer:
+		// GitHub lists the pending review requests when the pull request is
+		// ready for review, so there is nothing to remember.
+		l.Info("at", "defer_draft_review_request")
 		w.WriteHeader(http.StatusOK)
+	case webhook.Action == "review_requested" && webhook.RequestedTeam != nil:
+		c := ctx.WithLogger(context.Background(), l)
+		s.dispatch(c, w, func(c context.Context) error {
+			return s.Notifier.TeamReviewRequested(c, webhook.Repository, webhook.PullRequest, webhook.RequestedTeam)
+		})
+	case webhook.Action == "review_requested":
+		c := ctx.WithLogger(context.Background(), l)
+		s.dispatch(c, w, func(c context.Context) error {
+			return s.Notifier.ReviewRequested(c, webhook.Repository, webhook.PullRequest, webhook.RequestedReviewer)
+		})
+	case (webhook.Action == "opened" || webhook.Action == "ready_for_review") && s.Assigner != nil && needsReviewers(webhook.PullRequest):
+		c := ctx.WithLogger(context.Background(), l)
+		s.dispatch(c, w, func(c context.Context) error {
+			return s.Assigner.Assign(c, webhook.Repository, webhook.PullRequest)
+		})
+	case webhook.Action == "ready_for_review" && s.Drafts == DraftDefer:
+		c := ctx.WithLogger(context.Background(), l)
+		s.dispatch(c, w, func(c context.Context) error {
+			return s.notifyPendingReviewRequests(c, webhook.Repository, webhook.PullRequest)
+		})
+	case webhook.Action == "review_request_removed" && webhook.RequestedTeam != nil:
+		// Team review requests are remembered under "@" and the team's slug.
+		team := &github.User{Login: "@" + webhook.RequestedTeam.Slug}
+		c := ctx.WithLogger(context.Background(), l)
+		s.dispatch(c, w, func(c context.Context) error {
+			return s.Notifier.ReviewRequestRemoved(c, webhook.Repository, webhook.PullRequest, team, webhook.Sender)
+		})
+	case webhook.Action == "review_request_removed" && webhook.RequestedReviewer != nil:
+		c := ctx.WithLogger(context.Background(), l)
+		s.dispatch(c, w, func(c context.Context) error {
+			return s.Notifier.ReviewRequestRemoved(c, webhook.Repository, webhook.PullRequest, webhook.RequestedReviewer, webhook.Sender)
+		})
+	case webhook.Action == "closed" && webhook.PullRequest.Merged:
+		mergedBy := webhook.PullRequest.MergedBy
+		if mergedBy == nil {
+			mergedBy = webhook.Sender
+		}
+
+		c := ctx.WithLogger(context.Background(), l)
+		s.dispatch(c, w, func(c context.Context) error {
+			return s.Notifier.Merged(c, webhook.Repository, webhook.PullRequest, mergedBy)
+		})
+	case webhook.Action == "closed":
+		c := ctx.WithLogger(context.Background(), l)
+		s.dispatch(c, w, func(c context.Context) error {
+			return s.Notifier.Closed(c, webhook.Repository, webhook.PullRequest, webhook.Sender)
+		})
 	default:
 		l.Info("at", "ignore_pull_request_action")
 		w.WriteHeader(http.StatusOK)
 	}
 }
 
+// notifyPendingReviewRequests notifies about every review request that is
+// still pending on the pull request.
+func (s *Server) notifyPendingReviewRequests(c context.Context, repo *github.Repository, pr *github.PullRequest) error {
+	var errs []error
+	for _, reviewer := range pr.RequestedReviewers {
+		if err := s.Notifier.ReviewRequested(c, repo, pr, reviewer); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, team := range pr.RequestedTeams {
+		if err := s.Notifier.TeamReviewRequested(c, repo, pr, team); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func (s *Server) handlePullRequestReviewEvent(w http.ResponseWriter, r *http.Request, l log.LeveledLogger) {
 	var webhook github.PullRequestReviewWebhook
 
@@ -143,7 +472,7 @@ func (s *Server) handlePullRequestReviewEvent(w http.ResponseWriter, r *http.Req
 
 	l = webhook.EnhanceLogger(l)
 
-	if webhook.Action != "submitted" {
+	if webhook.Action != "submitted" && webhook.Action != "edited" && webhook.Action != "dismissed" {
 		l.Info("at", "ignore_review_action")
 		w.WriteHeader(http.StatusOK)
 		return
@@ -157,12 +486,150 @@ func (s *Server) handlePullRequestReviewEvent(w http.ResponseWriter, r *http.Req
 
 	c := ctx.WithLogger(context.Background(), l)
 
-	if webhook.Review.IsApproved() {
-		_ = s.Notifier.Approved(c, webhook.Repository, webhook.PullRequest, webhook.Review)
-	} else if webhook.Review.User.ID != webhook.PullRequest.User.ID {
-		_ = s.Notifier.ChangesRequested(c, webhook.Repository, webhook.PullRequest, webhook.Review)
-	}
+	s.dispatch(c, w, func(c context.Context) error {
+		switch {
+		case webhook.Action == "edited":
+			return s.Notifier.ReviewEdited(c, webhook.Repository, webhook.PullRequest, webhook.Review)
+		case webhook.Action == "dismissed":
+			return s.Notifier.ReviewDismissed(c, webhook.Repository, webhook.PullRequest, webhook.Review, webhook.Sender)
+		case webhook.Review.IsApproved():
+			return s.Notifier.Approved(c, webhook.Repository, webhook.PullRequest, webhook.Review)
+		case webhook.Review.User.ID == webhook.PullRequest.User.ID:
+			// Authors replying to reviews of their own pull request.
+			return nil
+		case webhook.Review.IsChangesRequested():
+			return s.Notifier.ChangesRequested(c, webhook.Repository, webhook.PullRequest, webhook.Review)
+		case webhook.Review.IsCommented() && strings.TrimSpace(webhook.Review.Body) != "":
+			// Reviews without a body only wrap review comments, which are
+			// notified about on their own.
+			return s.Notifier.Commented(c, webhook.Repository, webhook.PullRequest, webhook.Review)
+		}
+		return nil
+	})
 
 	l.Info("at", "pull_request_updated")
-	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handlePullRequestReviewCommentEvent(w http.ResponseWriter, r *http.Request, l log.LeveledLogger) {
+	var webhook github.PullRequestReviewCommentWebhook
+
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		_ = bugsnag.Notify(err)
+		l.Error("at", "unmarshal_error", "err", err)
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	l = webhook.EnhanceLogger(l)
+
+	if webhook.Action != "created" {
+		l.Info("at", "ignore_review_comment_action")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if err := webhook.Validate(); err != nil {
+		l.Error("at", "payload_error", "err", err)
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	c := ctx.WithLogger(context.Background(), l)
+	notify := func(c context.Context, comments []*github.Comment) error {
+		return s.Notifier.CommentsPosted(c, webhook.Repository, webhook.PullRequest, comments)
+	}
+
+	// Comments without a review can't be told apart from those of other
+	// reviews, so they are notified on their own.
+	if s.Comments == nil || webhook.Comment.PullRequestReviewID == 0 {
+		s.dispatch(c, w, func(c context.Context) error {
+			return notify(c, []*github.Comment{webhook.Comment})
+		})
+		return
+	}
+
+	// Comments made as part of the same review are notified together.
+	key := fmt.Sprintf("%s/%d", pullRequestKey(webhook.Repository, webhook.PullRequest), webhook.Comment.PullRequestReviewID)
+	s.Comments.Add(c, key, r.Header.Get("X-GitHub-Delivery"), webhook.Comment, func(c context.Context, comments []*github.Comment, deliveries []string) error {
+		err := s.process(c, func(c context.Context) error {
+			return notify(c, comments)
+		})
+		if err != nil {
+			// GitHub was told the comments were accepted, so they are only
+			// notified if it redelivers them.
+			for _, id := range deliveries {
+				s.forgetDelivery(id, ctx.Logger(c))
+			}
+		}
+		return err
+	})
+
+	l.Info("at", "review_comment_batched")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) handleIssueCommentEvent(w http.ResponseWriter, r *http.Request, l log.LeveledLogger) {
+	var webhook github.IssueCommentWebhook
+
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		_ = bugsnag.Notify(err)
+		l.Error("at", "unmarshal_error", "err", err)
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	l = webhook.EnhanceLogger(l)
+
+	if webhook.Action != "created" {
+		l.Info("at", "ignore_issue_comment_action")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if err := webhook.Validate(); err != nil {
+		l.Error("at", "payload_error", "err", err)
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	if !webhook.Issue.IsPullRequest() {
+		l.Info("at", "ignore_issue_comment")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	c := ctx.WithLogger(context.Background(), l)
+	s.dispatch(c, w, func(c context.Context) error {
+		return s.Notifier.CommentsPosted(c, webhook.Repository, webhook.Issue.AsPullRequest(), []*github.Comment{webhook.Comment})
+	})
+}
+
+// process runs the event handler on the event queue if the Server has one, or
+// straight away otherwise.
+func (s *Server) process(c context.Context, handler EventHandler) error {
+	if s.Queue == nil {
+		return handler(c)
+	}
+	return s.Queue.Enqueue(c, handler)
+}
+
+// dispatch runs the event handler, either on the event queue if the Server has
+// one, or straight away otherwise.
+func (s *Server) dispatch(c context.Context, w http.ResponseWriter, handler EventHandler) {
+	l := ctx.Logger(c)
+
+	if s.Queue == nil {
+		if err := handler(c); err != nil {
+			l.Error("at", "event_error", "err", err)
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if err := s.Queue.Enqueue(c, handler); err != nil {
+		l.Error("at", "enqueue_error", "err", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
 }
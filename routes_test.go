@@ -1,14 +1,20 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/geckoboard/cake-bot/github"
 	"github.com/geckoboard/cake-bot/log"
+	"github.com/geckoboard/cake-bot/store"
 	"github.com/slack-go/slack"
 )
 
@@ -17,6 +23,8 @@ type notification struct {
 	repo     *github.Repository
 	pr       *github.PullRequest
 	reviewer *github.User
+	team     *github.Team
+	comments []*github.Comment
 }
 
 type fakeNotifier struct {
@@ -24,17 +32,57 @@ type fakeNotifier struct {
 }
 
 func (f *fakeNotifier) Approved(_ context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review) error {
-	f.notifications = append(f.notifications, notification{"approved", repo, pr, review.User})
+	f.notifications = append(f.notifications, notification{action: "approved", repo: repo, pr: pr, reviewer: review.User})
 	return nil
 }
 
 func (f *fakeNotifier) ChangesRequested(_ context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review) error {
-	f.notifications = append(f.notifications, notification{"changes_requested", repo, pr, review.User})
+	f.notifications = append(f.notifications, notification{action: "changes_requested", repo: repo, pr: pr, reviewer: review.User})
+	return nil
+}
+
+func (f *fakeNotifier) Commented(_ context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review) error {
+	f.notifications = append(f.notifications, notification{action: "commented", repo: repo, pr: pr, reviewer: review.User})
+	return nil
+}
+
+func (f *fakeNotifier) ReviewEdited(_ context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review) error {
+	f.notifications = append(f.notifications, notification{action: "review_edited", repo: repo, pr: pr, reviewer: review.User})
+	return nil
+}
+
+func (f *fakeNotifier) ReviewDismissed(_ context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review, _ *github.User) error {
+	f.notifications = append(f.notifications, notification{action: "review_dismissed", repo: repo, pr: pr, reviewer: review.User})
 	return nil
 }
 
 func (f *fakeNotifier) ReviewRequested(_ context.Context, repo *github.Repository, pr *github.PullRequest, reviewer *github.User) error {
-	f.notifications = append(f.notifications, notification{"review_requested", repo, pr, reviewer})
+	f.notifications = append(f.notifications, notification{action: "review_requested", repo: repo, pr: pr, reviewer: reviewer})
+	return nil
+}
+
+func (f *fakeNotifier) TeamReviewRequested(_ context.Context, repo *github.Repository, pr *github.PullRequest, team *github.Team) error {
+	f.notifications = append(f.notifications, notification{action: "team_review_requested", repo: repo, pr: pr, team: team})
+	return nil
+}
+
+func (f *fakeNotifier) ReviewRequestRemoved(_ context.Context, repo *github.Repository, pr *github.PullRequest, reviewer *github.User, _ *github.User) error {
+	f.notifications = append(f.notifications, notification{action: "review_request_removed", repo: repo, pr: pr, reviewer: reviewer})
+	return nil
+}
+
+func (f *fakeNotifier) Merged(_ context.Context, repo *github.Repository, pr *github.PullRequest, mergedBy *github.User) error {
+	f.notifications = append(f.notifications, notification{action: "merged", repo: repo, pr: pr, reviewer: mergedBy})
+	return nil
+}
+
+func (f *fakeNotifier) Closed(_ context.Context, repo *github.Repository, pr *github.PullRequest, closedBy *github.User) error {
+	f.notifications = append(f.notifications, notification{action: "closed", repo: repo, pr: pr, reviewer: closedBy})
+	return nil
+}
+
+func (f *fakeNotifier) CommentsPosted(_ context.Context, repo *github.Repository, pr *github.PullRequest, comments []*github.Comment) error {
+	f.notifications = append(f.notifications, notification{action: "comments_posted", repo: repo, pr: pr, comments: comments})
 	return nil
 }
 
@@ -52,7 +100,7 @@ func TestHandlePullRequestEvent(t *testing.T) {
 	outcome := &fakeNotifier{}
 	validator := &fakeWebhookValidator{}
 
-	s := httptest.NewServer(NewServer(outcome, validator))
+	s := httptest.NewServer(NewServer(outcome, validator, validator))
 	defer s.Close()
 	webhookURL := s.URL + "/github"
 
@@ -99,7 +147,7 @@ func TestHandleReviewRequiresChanges(t *testing.T) {
 	outcome := &fakeNotifier{}
 	validator := &fakeWebhookValidator{}
 
-	s := httptest.NewServer(NewServer(outcome, validator))
+	s := httptest.NewServer(NewServer(outcome, validator, validator))
 	defer s.Close()
 	webhookURL := s.URL + "/github"
 
@@ -146,7 +194,7 @@ func TestHandleReviewApproved(t *testing.T) {
 	outcome := &fakeNotifier{}
 	validator := &fakeWebhookValidator{}
 
-	s := httptest.NewServer(NewServer(outcome, validator))
+	s := httptest.NewServer(NewServer(outcome, validator, validator))
 	defer s.Close()
 	webhookURL := s.URL + "/github"
 
@@ -192,3 +240,695 @@ func TestHandleReviewApproved(t *testing.T) {
 func init() {
 	logger = log.New()
 }
+
+func TestGitHubWebhookIgnoresDuplicateDeliveries(t *testing.T) {
+	outcome := &fakeNotifier{}
+	validator := &fakeWebhookValidator{}
+
+	s := httptest.NewServer(NewServer(outcome, validator, validator, WithDeliveryCache(newTestDeliveryCache(t))))
+	defer s.Close()
+	webhookURL := s.URL + "/github"
+
+	for i := 0; i < 2; i++ {
+		file, err := os.Open("./example-webhooks/pull_request_review_approved.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest("POST", webhookURL, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("X-Github-Event", "pull_request_review")
+		req.Header.Add("X-GitHub-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != 200 {
+			t.Errorf("expected status code to be 200, got %d", resp.StatusCode)
+		}
+	}
+
+	if len(outcome.notifications) != 1 {
+		t.Fatalf("expected 1 notification for a redelivered webhook, instead got: %#v", outcome.notifications)
+	}
+}
+
+func TestGitHubWebhookHandlesRedeliveriesOfRejectedDeliveries(t *testing.T) {
+	outcome := &fakeNotifier{}
+	validator := &fakeWebhookValidator{}
+	queue := NewEventQueue(1, 1)
+	if err := queue.Enqueue(context.Background(), func(context.Context) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	s := httptest.NewServer(NewServer(outcome, validator, validator,
+		WithEventQueue(queue),
+		WithDeliveryCache(newTestDeliveryCache(t)),
+	))
+	defer s.Close()
+
+	deliver := func() int {
+		t.Helper()
+		file, err := os.Open("./example-webhooks/pull_request_review_approved.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest("POST", s.URL+"/github", file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("X-Github-Event", "pull_request_review")
+		req.Header.Add("X-GitHub-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	if status := deliver(); status != http.StatusServiceUnavailable {
+		t.Fatalf("expected status code to be 503 while the queue is full, got %d", status)
+	}
+
+	<-queue.events
+	if status := deliver(); status != http.StatusAccepted {
+		t.Fatalf("expected the redelivery to be accepted, got %d", status)
+	}
+}
+
+func TestHandleReviewRequestRemoved(t *testing.T) {
+	outcome := &fakeNotifier{}
+	validator := &fakeWebhookValidator{}
+
+	s := httptest.NewServer(NewServer(outcome, validator, validator))
+	defer s.Close()
+
+	file, err := os.Open("./example-webhooks/pull_request_review_request_removed.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("POST", s.URL+"/github", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("X-Github-Event", "pull_request")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Errorf("expected status code to be 200, got %d", resp.StatusCode)
+	}
+
+	if len(outcome.notifications) != 1 || outcome.notifications[0].action != "review_request_removed" {
+		t.Fatalf("expected 1 review_request_removed notification, instead got: %#v", outcome.notifications)
+	}
+
+	if outcome.notifications[0].reviewer.ID != 20394 {
+		t.Fatalf("unexpected reviewer passed to notifier: %v", outcome.notifications[0].reviewer)
+	}
+}
+
+func TestHandleTeamReviewRequestRemoved(t *testing.T) {
+	outcome := &fakeNotifier{}
+	validator := &fakeWebhookValidator{}
+
+	s := httptest.NewServer(NewServer(outcome, validator, validator))
+	defer s.Close()
+
+	resp := sendExampleWebhook(t, s.URL, "pull_request", "pull_request_team_review_request_removed.json")
+	if resp.StatusCode != 200 {
+		t.Errorf("expected status code to be 200, got %d", resp.StatusCode)
+	}
+
+	if len(outcome.notifications) != 1 || outcome.notifications[0].action != "review_request_removed" {
+		t.Fatalf("expected 1 review_request_removed notification, instead got: %#v", outcome.notifications)
+	}
+	if outcome.notifications[0].reviewer.Login != "@backend" {
+		t.Fatalf("unexpected reviewer passed to notifier: %v", outcome.notifications[0].reviewer)
+	}
+}
+
+// sendExampleWebhook posts one of the example webhooks to the server.
+func sendExampleWebhook(t *testing.T, serverURL, event, filename string) *http.Response {
+	t.Helper()
+
+	file, err := os.Open("./example-webhooks/" + filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	req, err := http.NewRequest("POST", serverURL+"/github", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("X-Github-Event", event)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestHandleReviewCommented(t *testing.T) {
+	outcome := &fakeNotifier{}
+	validator := &fakeWebhookValidator{}
+
+	s := httptest.NewServer(NewServer(outcome, validator, validator))
+	defer s.Close()
+
+	resp := sendExampleWebhook(t, s.URL, "pull_request_review", "pull_request_review_commented.json")
+	if resp.StatusCode != 200 {
+		t.Errorf("expected status code to be 200, got %d", resp.StatusCode)
+	}
+
+	if len(outcome.notifications) != 1 {
+		t.Fatalf("expected 1 notification, instead got: %#v", outcome.notifications)
+	}
+	if outcome.notifications[0].action != "commented" {
+		t.Fatalf("expected notification to be commented, got: %q", outcome.notifications[0].action)
+	}
+}
+
+func TestHandleTeamReviewRequested(t *testing.T) {
+	outcome := &fakeNotifier{}
+	validator := &fakeWebhookValidator{}
+
+	s := httptest.NewServer(NewServer(outcome, validator, validator))
+	defer s.Close()
+
+	resp := sendExampleWebhook(t, s.URL, "pull_request", "pull_request_team_review_requested.json")
+	if resp.StatusCode != 200 {
+		t.Errorf("expected status code to be 200, got %d", resp.StatusCode)
+	}
+
+	if len(outcome.notifications) != 1 || outcome.notifications[0].action != "team_review_requested" {
+		t.Fatalf("expected 1 team_review_requested notification, instead got: %#v", outcome.notifications)
+	}
+
+	if outcome.notifications[0].team.Slug != "backend" {
+		t.Fatalf("unexpected team passed to notifier: %v", outcome.notifications[0].team)
+	}
+}
+
+func TestHandleDraftReviewRequested(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          []ServerOption
+		notifications int
+	}{
+		{"default", nil, 0},
+		{"empty", []ServerOption{WithDraftPolicy("")}, 1},
+		{"notify", []ServerOption{WithDraftPolicy(DraftNotify)}, 1},
+		{"suppress", []ServerOption{WithDraftPolicy(DraftSuppress)}, 0},
+		{"defer", []ServerOption{WithDraftPolicy(DraftDefer)}, 0},
+	}
+
+	for _, tt := range tests {
+		outcome := &fakeNotifier{}
+		validator := &fakeWebhookValidator{}
+
+		s := httptest.NewServer(NewServer(outcome, validator, validator, tt.opts...))
+
+		resp := sendExampleWebhook(t, s.URL, "pull_request", "pull_request_draft_review_requested.json")
+		if resp.StatusCode != 200 {
+			t.Errorf("%s: expected status code to be 200, got %d", tt.name, resp.StatusCode)
+		}
+
+		if len(outcome.notifications) != tt.notifications {
+			t.Errorf("%s: expected %d notifications, got: %#v", tt.name, tt.notifications, outcome.notifications)
+		}
+		s.Close()
+	}
+}
+
+func TestHandleReadyForReview(t *testing.T) {
+	outcome := &fakeNotifier{}
+	validator := &fakeWebhookValidator{}
+
+	s := httptest.NewServer(NewServer(outcome, validator, validator, WithDraftPolicy(DraftDefer)))
+	defer s.Close()
+
+	resp := sendExampleWebhook(t, s.URL, "pull_request", "pull_request_ready_for_review.json")
+	if resp.StatusCode != 200 {
+		t.Errorf("expected status code to be 200, got %d", resp.StatusCode)
+	}
+
+	if len(outcome.notifications) != 2 {
+		t.Fatalf("expected the deferred review requests to be sent, got: %#v", outcome.notifications)
+	}
+	if n := outcome.notifications[0]; n.action != "review_requested" || n.reviewer.Login != "BRMatt" {
+		t.Errorf("unexpected review request: %#v", n)
+	}
+	if n := outcome.notifications[1]; n.action != "team_review_requested" || n.team.Slug != "backend" {
+		t.Errorf("unexpected team review request: %#v", n)
+	}
+}
+
+func TestHandleReadyForReviewWithoutDeferring(t *testing.T) {
+	outcome := &fakeNotifier{}
+	validator := &fakeWebhookValidator{}
+
+	s := httptest.NewServer(NewServer(outcome, validator, validator, WithDraftPolicy(DraftSuppress)))
+	defer s.Close()
+
+	resp := sendExampleWebhook(t, s.URL, "pull_request", "pull_request_ready_for_review.json")
+	if resp.StatusCode != 200 {
+		t.Errorf("expected status code to be 200, got %d", resp.StatusCode)
+	}
+
+	if len(outcome.notifications) != 0 {
+		t.Fatalf("expected no notifications, got: %#v", outcome.notifications)
+	}
+}
+
+func TestHandlePullRequestOpenedWithoutReviewers(t *testing.T) {
+	outcome := &fakeNotifier{}
+	validator := &fakeWebhookValidator{}
+
+	pools := &ReviewerPools{Pools: []ReviewerPool{{Repositories: []string{"geckoboard/*"}, Reviewers: []string{"leocassarani", "BRMatt"}}}}
+	api := &fakeReviewerAPI{}
+	assigner := NewAssigner(api, pools, NewStoreReminderStore(store.NewMemory()), &fakeReassignNotifier{}, AssignRequest)
+
+	s := httptest.NewServer(NewServer(outcome, validator, validator, WithAssigner(assigner)))
+	defer s.Close()
+
+	resp := sendExampleWebhook(t, s.URL, "pull_request", "pull_request_opened.json")
+	if resp.StatusCode != 200 {
+		t.Errorf("expected status code to be 200, got %d", resp.StatusCode)
+	}
+
+	if len(api.requested) != 1 || api.requested[0] != "BRMatt" {
+		t.Errorf("expected a reviewer other than the author to be asked, got: %v", api.requested)
+	}
+	if len(outcome.notifications) != 0 {
+		t.Errorf("expected GitHub's webhook to notify the reviewer, got: %#v", outcome.notifications)
+	}
+}
+
+func TestStats(t *testing.T) {
+	validator := &fakeWebhookValidator{}
+	stats := NewStoreStatsStore(store.NewMemory())
+	_ = stats.Add(ReviewStat{Reviewer: "reviewer", State: "approved", SubmittedAt: time.Now().Add(-time.Hour)})
+	_ = stats.Add(ReviewStat{Reviewer: "reviewer", State: "approved", SubmittedAt: time.Now().AddDate(0, 0, -10)})
+
+	s := httptest.NewServer(NewServer(&fakeNotifier{}, validator, validator, WithStats(NewStats(stats, NewStoreReminderStore(store.NewMemory())), "s3cret")))
+	defer s.Close()
+
+	resp, err := http.Get(s.URL + "/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected status code to be 401 without the token, got %d", resp.StatusCode)
+	}
+
+	for _, c := range []struct {
+		query string
+		cakes int
+	}{{"", 1}, {"?days=14", 2}} {
+		req, _ := http.NewRequest("GET", s.URL+"/stats"+c.query, nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var board Leaderboard
+		err = json.NewDecoder(resp.Body).Decode(&board)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if board.Cakes != c.cakes || len(board.MostCakes) != 1 || board.MostCakes[0].Reviewer != "reviewer" {
+			t.Errorf("unexpected leaderboard for %q: %#v", c.query, board)
+		}
+	}
+}
+
+func TestStatsWithoutToken(t *testing.T) {
+	validator := &fakeWebhookValidator{}
+	stats := NewStats(NewStoreStatsStore(store.NewMemory()), NewStoreReminderStore(store.NewMemory()))
+
+	s := httptest.NewServer(NewServer(&fakeNotifier{}, validator, validator, WithStats(stats, "")))
+	defer s.Close()
+
+	resp, err := http.Get(s.URL + "/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status code to be 404 without a token, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandleSlashCommand(t *testing.T) {
+	commands, _ := newTestSlashCommands(t)
+	slackValidator := NewSlackRequestValidator("s3cr3t", DefaultSlackRequestMaxAge)
+
+	s := httptest.NewServer(NewServer(&fakeNotifier{}, &fakeWebhookValidator{}, slackValidator, WithSlashCommands(commands)))
+	defer s.Close()
+
+	body, err := os.ReadFile("./example-webhooks/slack_command_cake_queue.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("POST", s.URL+"/slack/command", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	fakeSlackSigner{"s3cr3t"}.sign(req, string(body), time.Now())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected status code to be 200, got %d", resp.StatusCode)
+	}
+
+	var msg struct {
+		ResponseType string          `json:"response_type"`
+		Blocks       json.RawMessage `json:"blocks"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.ResponseType != "ephemeral" {
+		t.Errorf("expected an ephemeral reply, got %q", msg.ResponseType)
+	}
+	if b := blocks(t, url.Values{"blocks": {string(msg.Blocks)}}); !strings.Contains(b, "You have 1 pull request waiting for your review") {
+		t.Errorf("expected the reviewer's queue, got blocks: %s", b)
+	}
+}
+
+func TestHandleSlashCommandRejectsUnsignedRequests(t *testing.T) {
+	commands, _ := newTestSlashCommands(t)
+	slackValidator := NewSlackRequestValidator("s3cr3t", DefaultSlackRequestMaxAge)
+
+	s := httptest.NewServer(NewServer(&fakeNotifier{}, &fakeWebhookValidator{}, slackValidator, WithSlashCommands(commands)))
+	defer s.Close()
+
+	body, err := os.ReadFile("./example-webhooks/slack_command_cake_queue.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Post(s.URL+"/slack/command", "application/x-www-form-urlencoded", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected status code to be 401, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandleReviewRequestedWithoutReviewer(t *testing.T) {
+	outcome := &fakeNotifier{}
+	validator := &fakeWebhookValidator{}
+
+	s := httptest.NewServer(NewServer(outcome, validator, validator))
+	defer s.Close()
+
+	body := `{"action": "review_requested", "pull_request": {"number": 1}, "repository": {"full_name": "geckoboard/cake-bot"}}`
+	req, err := http.NewRequest("POST", s.URL+"/github", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("X-Github-Event", "pull_request")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("expected status code to be 501, got %d", resp.StatusCode)
+	}
+
+	if len(outcome.notifications) != 0 {
+		t.Fatalf("expected no notifications, instead got: %#v", outcome.notifications)
+	}
+}
+
+func TestHandlePullRequestMerged(t *testing.T) {
+	outcome := &fakeNotifier{}
+	validator := &fakeWebhookValidator{}
+
+	s := httptest.NewServer(NewServer(outcome, validator, validator))
+	defer s.Close()
+
+	resp := sendExampleWebhook(t, s.URL, "pull_request", "pull_request_merged.json")
+	if resp.StatusCode != 200 {
+		t.Errorf("expected status code to be 200, got %d", resp.StatusCode)
+	}
+
+	if len(outcome.notifications) != 1 || outcome.notifications[0].action != "merged" {
+		t.Fatalf("expected 1 merged notification, instead got: %#v", outcome.notifications)
+	}
+
+	if outcome.notifications[0].pr.Number != 14 {
+		t.Fatalf("expected PR number %d, got: %v", 14, outcome.notifications[0].pr.Number)
+	}
+}
+
+func TestHandleReviewCommentCreated(t *testing.T) {
+	outcome := &fakeNotifier{}
+	validator := &fakeWebhookValidator{}
+	comments := NewCommentBatcher(time.Hour)
+
+	s := httptest.NewServer(NewServer(outcome, validator, validator, WithCommentBatcher(comments)))
+	defer s.Close()
+
+	for i := 0; i < 2; i++ {
+		resp := sendExampleWebhook(t, s.URL, "pull_request_review_comment", "pull_request_review_comment_created.json")
+		if resp.StatusCode != http.StatusAccepted {
+			t.Errorf("expected status code to be 202, got %d", resp.StatusCode)
+		}
+	}
+
+	if len(outcome.notifications) != 0 {
+		t.Fatalf("expected comments to be batched, instead got: %#v", outcome.notifications)
+	}
+
+	comments.Flush()
+
+	if len(outcome.notifications) != 1 || outcome.notifications[0].action != "comments_posted" {
+		t.Fatalf("expected 1 comments_posted notification, instead got: %#v", outcome.notifications)
+	}
+
+	if n := outcome.notifications[0]; len(n.comments) != 2 || n.comments[0].Path != "README.md" || n.pr.Number != 12 {
+		t.Fatalf("unexpected comments passed to notifier: %#v", n)
+	}
+}
+
+func TestHandleReviewCommentWithoutRepository(t *testing.T) {
+	outcome := &fakeNotifier{}
+	validator := &fakeWebhookValidator{}
+
+	s := httptest.NewServer(NewServer(outcome, validator, validator, WithCommentBatcher(NewCommentBatcher(time.Hour))))
+	defer s.Close()
+
+	payload := `{"action": "created", "comment": {"id": 1, "pull_request_review_id": 2}, "pull_request": {"number": 12}}`
+	req, err := http.NewRequest("POST", s.URL+"/github", strings.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("X-Github-Event", "pull_request_review_comment")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("expected status code to be 501, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandleReviewCommentRedeliveredWhenBatchIsRejected(t *testing.T) {
+	outcome := &fakeNotifier{}
+	validator := &fakeWebhookValidator{}
+	comments := NewCommentBatcher(time.Hour)
+	queue := NewEventQueue(1, 1)
+	if err := queue.Enqueue(context.Background(), func(context.Context) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	s := httptest.NewServer(NewServer(outcome, validator, validator,
+		WithEventQueue(queue),
+		WithDeliveryCache(newTestDeliveryCache(t)),
+		WithCommentBatcher(comments),
+	))
+	defer s.Close()
+
+	deliver := func(id string) int {
+		t.Helper()
+		file, err := os.Open("./example-webhooks/pull_request_review_comment_created.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest("POST", s.URL+"/github", file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("X-Github-Event", "pull_request_review_comment")
+		req.Header.Add("X-GitHub-Delivery", id)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	for _, id := range []string{"delivery-1", "delivery-2"} {
+		if status := deliver(id); status != http.StatusAccepted {
+			t.Fatalf("expected status code to be 202, got %d", status)
+		}
+	}
+
+	// The queue is full, so the batch can't be handled.
+	comments.Flush()
+
+	for _, id := range []string{"delivery-1", "delivery-2"} {
+		if status := deliver(id); status != http.StatusAccepted {
+			t.Errorf("expected the redelivery of %s to be accepted, got %d", id, status)
+		}
+	}
+}
+
+func TestHandleReviewCommentWithoutReview(t *testing.T) {
+	outcome := &fakeNotifier{}
+	validator := &fakeWebhookValidator{}
+
+	s := httptest.NewServer(NewServer(outcome, validator, validator, WithCommentBatcher(NewCommentBatcher(time.Hour))))
+	defer s.Close()
+
+	payload := `{"action": "created", "comment": {"id": 1}, "pull_request": {"number": 12}, "repository": {"full_name": "geckoboard/cake-bot"}}`
+	req, err := http.NewRequest("POST", s.URL+"/github", strings.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("X-Github-Event", "pull_request_review_comment")
+
+	if _, err := http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(outcome.notifications) != 1 || outcome.notifications[0].action != "comments_posted" {
+		t.Fatalf("expected the comment to be notified without batching, instead got: %#v", outcome.notifications)
+	}
+}
+
+func TestHandleIssueCommentOnPullRequest(t *testing.T) {
+	outcome := &fakeNotifier{}
+	validator := &fakeWebhookValidator{}
+
+	s := httptest.NewServer(NewServer(outcome, validator, validator))
+	defer s.Close()
+
+	resp := sendExampleWebhook(t, s.URL, "issue_comment", "issue_comment.json")
+	if resp.StatusCode != 200 {
+		t.Errorf("expected status code to be 200, got %d", resp.StatusCode)
+	}
+
+	if len(outcome.notifications) != 1 || outcome.notifications[0].action != "comments_posted" {
+		t.Fatalf("expected 1 comments_posted notification, instead got: %#v", outcome.notifications)
+	}
+
+	if n := outcome.notifications[0]; n.pr.Number != 4 || n.pr.User.Login != "aitkenster" || n.comments[0].Body != "Test comment" {
+		t.Fatalf("unexpected comment passed to notifier: %#v", n)
+	}
+}
+
+func TestHandleReviewDismissed(t *testing.T) {
+	outcome := &fakeNotifier{}
+	validator := &fakeWebhookValidator{}
+
+	s := httptest.NewServer(NewServer(outcome, validator, validator))
+	defer s.Close()
+
+	resp := sendExampleWebhook(t, s.URL, "pull_request_review", "pull_request_review_dismissed.json")
+	if resp.StatusCode != 200 {
+		t.Errorf("expected status code to be 200, got %d", resp.StatusCode)
+	}
+
+	if len(outcome.notifications) != 1 || outcome.notifications[0].action != "review_dismissed" {
+		t.Fatalf("expected 1 review_dismissed notification, instead got: %#v", outcome.notifications)
+	}
+
+	if outcome.notifications[0].reviewer.ID != 12532520 {
+		t.Fatalf("unexpected review passed to notifier: %v", outcome.notifications[0].reviewer)
+	}
+}
+
+func TestHandleSlackInteractionSuggestsReviewer(t *testing.T) {
+	outcome := &fakeNotifier{}
+	validator := &fakeWebhookValidator{}
+	api := &fakeReviewerAPI{pr: &github.PullRequest{Number: 12, User: &github.User{Login: "author"}}}
+	pools := &ReviewerPools{Pools: []ReviewerPool{{Repositories: []string{"geckoboard/*"}, Reviewers: []string{"reviewer", "free"}}}}
+	notifier := &fakeReassignNotifier{}
+
+	s := httptest.NewServer(NewServer(outcome, validator, validator, WithReassigner(NewReassigner(api, pools, notifier))))
+	defer s.Close()
+
+	payload, err := json.Marshal(newInteraction(buildReviewerResponseBlockID(pullRequestKey(testRepo, testPR), "reviewer"), unableToReviewStatusMsg))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.PostForm(s.URL+"/slack/interact", url.Values{"payload": {string(payload)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("expected status code to be 200, got %d", resp.StatusCode)
+	}
+
+	if len(notifier.suggestions) != 1 || notifier.suggestions[0].To == nil || notifier.suggestions[0].To.Login != "free" {
+		t.Fatalf("expected free to be suggested, got: %#v", notifier.suggestions)
+	}
+}
+
+func TestHandleSlackInteractionRejectsInvalidPayloads(t *testing.T) {
+	validator := &fakeWebhookValidator{}
+
+	s := httptest.NewServer(NewServer(&fakeNotifier{}, validator, validator))
+	defer s.Close()
+
+	for payload, status := range map[string]int{
+		"{":                               http.StatusBadRequest,
+		`{"type":"block_actions"}`:        http.StatusNotFound,
+		`{"actions":[],"type":"unknown"}`: http.StatusNotFound,
+	} {
+		resp, err := http.PostForm(s.URL+"/slack/interact", url.Values{"payload": {payload}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("expected status code %d for %s, got %d", status, payload, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+
+	"github.com/geckoboard/cake-bot/github"
+)
+
+// ChannelRouter decides which Slack channels are notified about a pull
+// request.
+type ChannelRouter struct {
+	// Default lists the channels used when no route matches.
+	Default []string       `json:"default"`
+	Routes  []ChannelRoute `json:"routes"`
+
+	// Teams maps GitHub team slugs to the Slack user group to mention, and
+	// the extra channels to notify, when the team is asked for a review.
+	Teams map[string]TeamRoute `json:"teams"`
+}
+
+type TeamRoute struct {
+	// UserGroup is the ID of a Slack user group, e.g. "S0123456789".
+	UserGroup string   `json:"usergroup"`
+	Channels  []string `json:"channels"`
+}
+
+// ChannelRoute sends notifications to Channels when a pull request matches all
+// of the criteria that are set. Each criterion matches if any of its values
+// match.
+type ChannelRoute struct {
+	// Repositories are full repository names, e.g. "geckoboard/cake-bot".
+	// Glob patterns such as "geckoboard/api-*" are allowed.
+	Repositories []string `json:"repositories"`
+	Labels       []string `json:"labels"`
+	BaseBranches []string `json:"base_branches"`
+
+	Channels []string `json:"channels"`
+}
+
+// NewChannelRouter returns a router that sends everything to channel.
+func NewChannelRouter(channel string) *ChannelRouter {
+	return &ChannelRouter{Default: []string{channel}}
+}
+
+// LoadChannelRouter reads and validates a routing table from a JSON file.
+func LoadChannelRouter(filename string) (*ChannelRouter, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var router ChannelRouter
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&router); err != nil {
+		return nil, fmt.Errorf("couldn't parse %s: %w", filename, err)
+	}
+
+	if err := router.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid routing in %s: %w", filename, err)
+	}
+	return &router, nil
+}
+
+func (r *ChannelRouter) Validate() error {
+	if len(r.Default) == 0 {
+		return errors.New("no default channel")
+	}
+
+	for i, route := range r.Routes {
+		if len(route.Channels) == 0 {
+			return fmt.Errorf("route %d has no channels", i)
+		}
+
+		if len(route.Repositories) == 0 && len(route.Labels) == 0 && len(route.BaseBranches) == 0 {
+			return fmt.Errorf("route %d has no repositories, labels or base branches to match", i)
+		}
+
+		for _, pattern := range route.Repositories {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("route %d has invalid repository pattern %q", i, pattern)
+			}
+		}
+	}
+
+	for slug, team := range r.Teams {
+		if team.UserGroup == "" && len(team.Channels) == 0 {
+			return fmt.Errorf("team %q has no user group or channels", slug)
+		}
+	}
+	return nil
+}
+
+// Team returns how to notify the GitHub team, which is the zero TeamRoute if
+// the team isn't configured.
+func (r *ChannelRouter) Team(slug string) TeamRoute {
+	return r.Teams[slug]
+}
+
+// Channels returns the channels to notify about the pull request, without
+// duplicates.
+func (r *ChannelRouter) Channels(repo *github.Repository, pr *github.PullRequest) []string {
+	var channels []string
+	seen := make(map[string]bool)
+
+	for _, route := range r.Routes {
+		if !route.matches(repo, pr) {
+			continue
+		}
+
+		for _, channel := range route.Channels {
+			if !seen[channel] {
+				seen[channel] = true
+				channels = append(channels, channel)
+			}
+		}
+	}
+
+	if len(channels) == 0 {
+		return r.Default
+	}
+	return channels
+}
+
+// TeamChannels returns the channels to notify when the team is asked to
+// review the pull request.
+func (r *ChannelRouter) TeamChannels(repo *github.Repository, pr *github.PullRequest, slug string) []string {
+	channels := slices.Clone(r.Channels(repo, pr))
+	for _, channel := range r.Team(slug).Channels {
+		if !slices.Contains(channels, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+func (route *ChannelRoute) matches(repo *github.Repository, pr *github.PullRequest) bool {
+	if len(route.Repositories) > 0 && !matchesAny(route.Repositories, repo.FullName) {
+		return false
+	}
+
+	if len(route.BaseBranches) > 0 && !slices.Contains(route.BaseBranches, pr.BaseRef()) {
+		return false
+	}
+
+	if len(route.Labels) > 0 {
+		var labels []string
+		for _, l := range pr.Labels {
+			labels = append(labels, l.Name)
+		}
+
+		if !containsAny(route.Labels, labels) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(values []string, candidates []string) bool {
+	for _, c := range candidates {
+		if slices.Contains(values, c) {
+			return true
+		}
+	}
+	return false
+}
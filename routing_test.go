@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/geckoboard/cake-bot/github"
+)
+
+func TestChannelRouterChannels(t *testing.T) {
+	router := &ChannelRouter{
+		Default: []string{"#devs"},
+		Routes: []ChannelRoute{
+			{Repositories: []string{"geckoboard/api-*"}, Channels: []string{"#squad-api"}},
+			{Labels: []string{"frontend", "css"}, Channels: []string{"#squad-web"}},
+			{Repositories: []string{"geckoboard/api-gateway"}, BaseBranches: []string{"release"}, Channels: []string{"#releases", "#squad-api"}},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		repo     string
+		labels   []string
+		base     string
+		expected []string
+	}{
+		{"no match falls back to default", "geckoboard/cake-bot", nil, "master", []string{"#devs"}},
+		{"repository glob", "geckoboard/api-gateway", nil, "master", []string{"#squad-api"}},
+		{"glob doesn't cross owners", "someone/geckoboard/api-gateway", nil, "master", []string{"#devs"}},
+		{"any label matches", "geckoboard/cake-bot", []string{"bug", "css"}, "master", []string{"#squad-web"}},
+		{"all criteria must match", "geckoboard/api-gateway", nil, "release", []string{"#squad-api", "#releases"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			pr := &github.PullRequest{Base: &github.Branch{Ref: tc.base}}
+			for _, l := range tc.labels {
+				pr.Labels = append(pr.Labels, github.Label{Name: l})
+			}
+
+			got := router.Channels(&github.Repository{FullName: tc.repo}, pr)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Fatalf("expected channels %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestLoadChannelRouter(t *testing.T) {
+	cases := []struct {
+		name   string
+		config string
+		valid  bool
+	}{
+		{"valid", `{"default": ["#devs"], "routes": [{"repositories": ["geckoboard/*"], "channels": ["#gecko"]}]}`, true},
+		{"missing default", `{"routes": []}`, false},
+		{"route without channels", `{"default": ["#devs"], "routes": [{"labels": ["bug"]}]}`, false},
+		{"route without criteria", `{"default": ["#devs"], "routes": [{"channels": ["#gecko"]}]}`, false},
+		{"invalid glob", `{"default": ["#devs"], "routes": [{"repositories": ["geckoboard/[api"], "channels": ["#gecko"]}]}`, false},
+		{"unknown field", `{"default": ["#devs"], "channel": "#devs"}`, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "routes.json")
+			if err := os.WriteFile(filename, []byte(tc.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := LoadChannelRouter(filename)
+			if tc.valid && err != nil {
+				t.Fatalf("expected config to be valid, got: %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Fatal("expected config to be rejected")
+			}
+		})
+	}
+}
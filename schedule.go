@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/geckoboard/cake-bot/ctx"
+)
+
+// Weekdays are Monday to Friday.
+var Weekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+
+// ScheduledJob runs a function at the same time of day on some days of the
+// week, e.g. to post a digest every weekday morning.
+type ScheduledJob struct {
+	at   time.Duration
+	loc  *time.Location
+	days []time.Weekday
+	run  func(context.Context) error
+	now  func() time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewScheduledJob instantiates a ScheduledJob that runs at a time of day such
+// as "09:30" in loc, on days.
+func NewScheduledJob(at string, loc *time.Location, days []time.Weekday, run func(context.Context) error) (*ScheduledJob, error) {
+	d, err := parseTimeOfDay(at)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ScheduledJob{
+		at:   d,
+		loc:  loc,
+		days: days,
+		run:  run,
+		now:  time.Now,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}, nil
+}
+
+// Next returns the first time after t that the job should run.
+func (j *ScheduledJob) Next(t time.Time) time.Time {
+	t = t.In(j.loc)
+	for offset := 0; offset <= 7; offset++ {
+		day := time.Date(t.Year(), t.Month(), t.Day()+offset, 0, 0, 0, 0, j.loc)
+		if next := atTimeOfDay(day, j.at); next.After(t) && slices.Contains(j.days, day.Weekday()) {
+			return next
+		}
+	}
+	// There are no days to run on.
+	return time.Time{}
+}
+
+// Start runs the job on schedule until Stop is called.
+func (j *ScheduledJob) Start() {
+	go func() {
+		defer close(j.done)
+
+		c := ctx.WithLogger(context.Background(), logger)
+		for {
+			next := j.Next(j.now())
+			if next.IsZero() {
+				return
+			}
+
+			timer := time.NewTimer(next.Sub(j.now()))
+			select {
+			case <-timer.C:
+				if err := j.run(c); err != nil {
+					ctx.Logger(c).Error("at", "scheduled_job_error", "err", err)
+				}
+			case <-j.stop:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop waits for the job if it is running, and stops running it.
+func (j *ScheduledJob) Stop() {
+	close(j.stop)
+	<-j.done
+}
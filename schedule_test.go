@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestScheduledJobNext(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := NewScheduledJob("09:00", loc, Weekdays, func(context.Context) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{"early morning", time.Date(2024, 1, 3, 7, 0, 0, 0, loc), time.Date(2024, 1, 3, 9, 0, 0, 0, loc)},
+		{"on time", time.Date(2024, 1, 3, 9, 0, 0, 0, loc), time.Date(2024, 1, 4, 9, 0, 0, 0, loc)},
+		{"friday afternoon", time.Date(2024, 1, 5, 14, 0, 0, 0, loc), time.Date(2024, 1, 8, 9, 0, 0, 0, loc)},
+		// 07:00 in London during summer time.
+		{"another timezone", time.Date(2024, 7, 3, 6, 0, 0, 0, time.UTC), time.Date(2024, 7, 3, 9, 0, 0, 0, loc)},
+	}
+
+	for _, tt := range tests {
+		if got := job.Next(tt.t); !got.Equal(tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	// Clocks go forward an hour on the last Sunday of March, and back on the
+	// last Sunday of October.
+	job, err = NewScheduledJob("09:00", loc, []time.Weekday{time.Sunday}, func(context.Context) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests = []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{"clocks go forward", time.Date(2024, 3, 31, 0, 30, 0, 0, loc), time.Date(2024, 3, 31, 9, 0, 0, 0, loc)},
+		{"clocks go back", time.Date(2024, 10, 27, 0, 30, 0, 0, loc), time.Date(2024, 10, 27, 9, 0, 0, 0, loc)},
+	}
+
+	for _, tt := range tests {
+		if got := job.Next(tt.t); !got.Equal(tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
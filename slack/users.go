@@ -1,18 +1,164 @@
 package slack
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/geckoboard/cake-bot/store"
 	"github.com/slack-go/slack"
 )
 
 var Users = &users{}
 
 type users struct {
-	users atomic.Pointer[map[string]slack.User]
+	users atomic.Pointer[userMap]
+
+	// mu guards profiles, store and overrides. It isn't held while profiles
+	// are fetched.
+	mu       sync.Mutex
+	profiles map[string]cachedProfile
+	store    store.Store
+
+	// overrides maps lower case GitHub usernames to the ID or email of a
+	// Slack user, replacing what their profiles say.
+	overrides map[string]string
+
+	// emails finds the emails of GitHub users that can't be found
+	// otherwise, which are kept in emailCache for emailTTL.
+	emails     EmailFinder
+	emailTTL   time.Duration
+	emailMu    sync.Mutex
+	emailCache map[string]cachedEmails
+	// emailLogins maps the emails in emailCache to the GitHub usernames
+	// they belong to.
+	emailLogins map[string]map[string]bool
+	// emailLookups are the lookups in progress by GitHub username, which
+	// are closed once they are done.
+	emailLookups map[string]chan struct{}
+	// emailsPausedUntil is when emails can be looked up again after GitHub
+	// rate limited a lookup.
+	emailsPausedUntil time.Time
+	now               func() time.Time
+}
+
+// MatchSource is how a GitHub user was matched to a Slack user.
+type MatchSource string
+
+const (
+	// MatchedByField matched the GitHub field of the Slack profile.
+	MatchedByField MatchSource = "field"
+	// MatchedByOverride matched a user override.
+	MatchedByOverride MatchSource = "override"
+	// MatchedByEmail matched an email of the GitHub user to the email of
+	// the Slack profile.
+	MatchedByEmail MatchSource = "email"
+)
+
+// Match is the Slack user of a GitHub user, and how they were matched.
+type Match struct {
+	GitHub string
+	User   slack.User
+	Source MatchSource
+	// Email is the email they were matched by, if they were.
+	Email string
+}
+
+// userMap looks users up both ways.
+type userMap struct {
+	// byGitHub maps lower case GitHub usernames to their match.
+	byGitHub map[string]Match
+	// byID maps Slack user IDs to their lower case GitHub username. Users
+	// with several only get the one in their profile.
+	byID map[string]string
+	// byEmail maps lower case emails to the Slack user with it.
+	byEmail map[string]slack.User
+	// emails maps Slack user IDs to their lower case email.
+	emails map[string]string
+	// unknown are the overridden GitHub usernames whose Slack user couldn't
+	// be found.
+	unknown []string
+}
+
+// EmailFinder finds the emails of a GitHub user. *github.Client implements
+// it.
+type EmailFinder interface {
+	UserEmails(c context.Context, login string) ([]string, error)
+}
+
+const (
+	// emailLookupTimeout is how long looking up someone's emails can take.
+	emailLookupTimeout = 5 * time.Second
+	// emailRetryAfter is how long until emails that couldn't be looked up
+	// are first looked up again. It doubles with each failure, up to the
+	// TTL.
+	emailRetryAfter = time.Minute
+)
+
+type cachedEmails struct {
+	emails    []string
+	err       error
+	fetchedAt time.Time
+	// failures is how many times in a row the emails couldn't be looked
+	// up.
+	failures int
+}
+
+// retryAfter is how long until the emails are looked up again after failing.
+func (e cachedEmails) retryAfter(ttl time.Duration) time.Duration {
+	delay := emailRetryAfter
+	for i := 1; i < e.failures && delay < ttl; i++ {
+		delay *= 2
+	}
+	return min(delay, ttl)
 }
 
+// cachedProfile is what is known of a Slack user as of their last update, so
+// that their profile is only fetched again once it changes.
+type cachedProfile struct {
+	User slack.User `json:"user"`
+	// GitHub is the username in the custom profile field with the ID
+	// FieldID when the profile was fetched.
+	GitHub  string `json:"github,omitempty"`
+	FieldID string `json:"field_id"`
+}
+
+// Restore loads the users saved in s by previous refreshes, and saves the
+// users to it from now on.
+func (c *users) Restore(s store.Store) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	profiles := make(map[string]cachedProfile)
+	err := s.Scan(store.SlackUsers, "", func(id string, value []byte) error {
+		var profile cachedProfile
+		if err := json.Unmarshal(value, &profile); err != nil {
+			return fmt.Errorf("slack user %s: %w", id, err)
+		}
+		profiles[id] = profile
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.store = s
+	c.profiles = profiles
+	c.publish()
+	return nil
+}
+
+// Load refreshes the users, only fetching the profiles of those that have
+// been updated since they were last fetched. Users whose profile can't be
+// fetched keep the one fetched previously, if any, and the errors are
+// returned once everyone else has been refreshed.
 func (c *users) Load(api *Client) error {
 	team, err := api.GetTeamProfile()
 	if err != nil {
@@ -26,37 +172,380 @@ func (c *users) Load(api *Client) error {
 		return err
 	}
 
-	m := make(map[string]slack.User)
+	// Profiles are fetched without holding the lock, so that looking users
+	// up and replacing the overrides aren't held up by the Slack API.
+	c.mu.Lock()
+	previous := c.profiles
+	c.mu.Unlock()
+
+	var errs []error
+	profiles := make(map[string]cachedProfile, len(users))
+	var fetched []string
 
 	for _, u := range users {
+		if u.Deleted {
+			continue
+		}
+
+		cached, ok := previous[u.ID]
+		if ok && cached.User.Updated == u.Updated && cached.FieldID == githubFieldID {
+			profiles[u.ID] = cached
+			continue
+		}
+
 		profile, err := api.GetUserProfile(u.ID)
 		if err != nil {
-			return err
+			errs = append(errs, fmt.Errorf("slack user %s: %w", u.ID, err))
+			if ok {
+				profiles[u.ID] = cached
+			}
+			continue
+		}
+
+		profiles[u.ID] = cachedProfile{
+			User:    u,
+			GitHub:  findGitHubUsernameFromCustomFieldID(githubFieldID, profile),
+			FieldID: githubFieldID,
 		}
+		fetched = append(fetched, u.ID)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-		if name := findGitHubUsernameFromCustomFieldID(githubFieldID, profile); name != "" {
-			m[strings.ToLower(name)] = u
+	for _, id := range fetched {
+		profile := profiles[id]
+		errs = append(errs, c.save(id, &profile))
+	}
+	for id := range c.profiles {
+		if _, ok := profiles[id]; !ok {
+			errs = append(errs, c.save(id, nil))
 		}
 	}
 
-	c.users.Store(&m)
+	c.profiles = profiles
+	c.publish()
+	return errors.Join(errs...)
+}
+
+// save saves the profile of the user with the ID, or forgets them if it is
+// nil.
+func (c *users) save(id string, profile *cachedProfile) error {
+	if c.store == nil {
+		return nil
+	}
+	if profile == nil {
+		return c.store.Delete(store.SlackUsers, id)
+	}
+	return store.PutJSON(c.store, store.SlackUsers, id, profile)
+}
+
+// SetOverrides replaces the overrides, which map GitHub usernames to the ID
+// or email of a Slack user, on top of what profiles say.
+func (c *users) SetOverrides(overrides map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.overrides = make(map[string]string, len(overrides))
+	for name, target := range overrides {
+		c.overrides[strings.ToLower(name)] = target
+	}
+	if c.profiles != nil {
+		c.publish()
+	}
+}
+
+// UnknownOverrides returns the overridden GitHub usernames whose Slack user
+// couldn't be found amongst the users loaded so far, sorted.
+func (c *users) UnknownOverrides() []string {
+	if m := c.users.Load(); m != nil {
+		return m.unknown
+	}
 	return nil
 }
 
-func (c *users) FindByGitHubUsername(name string) *slack.User {
+// publish replaces the users that are looked up with the cached profiles and
+// the overrides.
+func (c *users) publish() {
+	m := &userMap{
+		byGitHub: make(map[string]Match),
+		byID:     make(map[string]string),
+		byEmail:  make(map[string]slack.User),
+		emails:   make(map[string]string),
+	}
+
+	byTarget := make(map[string]slack.User)
+	for _, profile := range c.profiles {
+		byTarget[profile.User.ID] = profile.User
+		if email := strings.ToLower(profile.User.Profile.Email); email != "" {
+			byTarget[email] = profile.User
+			m.byEmail[email] = profile.User
+			m.emails[profile.User.ID] = email
+		}
+
+		if profile.GitHub != "" {
+			name := strings.ToLower(profile.GitHub)
+			m.byGitHub[name] = Match{GitHub: name, User: profile.User, Source: MatchedByField}
+			m.byID[profile.User.ID] = name
+		}
+	}
+
+	names := make([]string, 0, len(c.overrides))
+	for name := range c.overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var overridden []string
+	for _, name := range names {
+		target := c.overrides[name]
+		u, ok := byTarget[target]
+		if !ok {
+			u, ok = byTarget[strings.ToLower(target)]
+		}
+		if !ok {
+			m.unknown = append(m.unknown, name)
+			continue
+		}
+
+		if previous, ok := m.byGitHub[name]; ok && m.byID[previous.User.ID] == name {
+			delete(m.byID, previous.User.ID)
+		}
+		m.byGitHub[name] = Match{GitHub: name, User: u, Source: MatchedByOverride}
+		overridden = append(overridden, name)
+	}
+
+	// Slack users without a GitHub username of their own get the first one
+	// they are overridden with.
+	for _, name := range overridden {
+		if id := m.byGitHub[name].User.ID; m.byID[id] == "" {
+			m.byID[id] = name
+		}
+	}
+	sort.Strings(m.unknown)
+
+	c.users.Store(m)
+}
+
+// MatchByEmail makes GitHub users that can't be found by their Slack profile
+// or an override be matched by their emails instead, which finder looks up
+// and are kept for ttl.
+func (c *users) MatchByEmail(finder EmailFinder, ttl time.Duration) {
+	c.emailMu.Lock()
+	defer c.emailMu.Unlock()
+
+	c.emails = finder
+	c.emailTTL = ttl
+	c.emailCache = make(map[string]cachedEmails)
+	c.emailLogins = make(map[string]map[string]bool)
+	c.emailLookups = make(map[string]chan struct{})
+	if c.now == nil {
+		c.now = time.Now
+	}
+}
+
+// FindMatch returns the Slack user of the GitHub user and how they were
+// matched, or nil if they can't be found. Users matched by email are only
+// found once their emails have been looked up, which FindMatch starts in the
+// background rather than holding up the caller.
+func (c *users) FindMatch(name string) *Match {
 	m := c.users.Load()
 	if m == nil {
 		// We haven't loaded all users yet, bail out.
 		return nil
 	}
 
-	if u, ok := (*m)[strings.ToLower(name)]; ok {
-		return &u
+	name = strings.ToLower(name)
+	if match, ok := m.byGitHub[name]; ok {
+		return &match
+	}
+
+	// Bots have no emails, and overridden users are meant to be found by
+	// their override only.
+	if strings.HasSuffix(name, "[bot]") || isOverridden(m, name) {
+		return nil
+	}
+
+	for _, email := range c.lookupEmails(name) {
+		if u, ok := m.byEmail[email]; ok {
+			return &Match{GitHub: name, User: u, Source: MatchedByEmail, Email: email}
+		}
+	}
+	return nil
+}
+
+// AwaitMatch is FindMatch, but waits for the emails of the GitHub user to be
+// looked up, or for c to be done.
+func (c *users) AwaitMatch(ctx context.Context, name string) *Match {
+	match := c.FindMatch(name)
+
+	c.emailMu.Lock()
+	done := c.emailLookups[strings.ToLower(name)]
+	c.emailMu.Unlock()
+
+	if done == nil {
+		return match
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	return c.FindMatch(name)
+}
+
+// lookupEmails returns the lower case emails of the GitHub user known so far,
+// if matching by email is enabled, and looks them up again in the background
+// once they have expired.
+func (c *users) lookupEmails(name string) []string {
+	c.emailMu.Lock()
+	defer c.emailMu.Unlock()
+
+	if c.emails == nil {
+		return nil
+	}
+
+	now := c.now()
+	cached, ok := c.emailCache[name]
+	if (!ok || c.emailsExpired(cached, now)) && !now.Before(c.emailsPausedUntil) {
+		c.startEmailLookup(name)
+	}
+	return cached.emails
+}
+
+func (c *users) emailsExpired(cached cachedEmails, now time.Time) bool {
+	expiry := c.emailTTL
+	if cached.err != nil {
+		expiry = cached.retryAfter(c.emailTTL)
+	}
+	return now.Sub(cached.fetchedAt) >= expiry
+}
+
+// startEmailLookup looks up the emails of the GitHub user in the background,
+// unless they are being looked up already. emailMu must be held.
+func (c *users) startEmailLookup(name string) {
+	if _, ok := c.emailLookups[name]; ok {
+		return
+	}
+
+	done := make(chan struct{})
+	c.emailLookups[name] = done
+
+	go func(finder EmailFinder) {
+		ctx, cancel := context.WithTimeout(context.Background(), emailLookupTimeout)
+		emails, err := finder.UserEmails(ctx, name)
+		cancel()
+		for i, email := range emails {
+			emails[i] = strings.ToLower(email)
+		}
+
+		c.emailMu.Lock()
+		defer c.emailMu.Unlock()
+
+		now := c.now()
+		failures := 0
+		if err != nil {
+			// Keep using the emails found previously until they can be
+			// looked up again.
+			emails = c.emailCache[name].emails
+			failures = c.emailCache[name].failures + 1
+		}
+		cached := &cachedEmails{emails: emails, err: err, fetchedAt: now, failures: failures}
+
+		var limited interface{ RateLimited() bool }
+		if errors.As(err, &limited) && limited.RateLimited() {
+			// Nobody's emails can be looked up until the rate limit
+			// resets.
+			c.emailsPausedUntil = now.Add(cached.retryAfter(c.emailTTL))
+		}
+
+		c.setEmails(name, cached)
+		c.pruneEmails(now)
+
+		delete(c.emailLookups, name)
+		close(done)
+	}(c.emails)
+}
+
+// setEmails caches the emails of the GitHub user, or forgets them if cached
+// is nil. emailMu must be held.
+func (c *users) setEmails(name string, cached *cachedEmails) {
+	for _, email := range c.emailCache[name].emails {
+		delete(c.emailLogins[email], name)
+		if len(c.emailLogins[email]) == 0 {
+			delete(c.emailLogins, email)
+		}
+	}
+
+	if cached == nil {
+		delete(c.emailCache, name)
+		return
 	}
 
+	c.emailCache[name] = *cached
+	for _, email := range cached.emails {
+		if c.emailLogins[email] == nil {
+			c.emailLogins[email] = make(map[string]bool)
+		}
+		c.emailLogins[email][name] = true
+	}
+}
+
+// pruneEmails forgets the emails that were looked up longer than the TTL ago,
+// and that nobody has needed since. emailMu must be held.
+func (c *users) pruneEmails(now time.Time) {
+	for name, cached := range c.emailCache {
+		if _, ok := c.emailLookups[name]; !ok && now.Sub(cached.fetchedAt) >= c.emailTTL {
+			c.setEmails(name, nil)
+		}
+	}
+}
+
+// isOverridden reports whether the GitHub user has an override, even if its
+// Slack user couldn't be found.
+func isOverridden(m *userMap, name string) bool {
+	_, ok := slices.BinarySearch(m.unknown, name)
+	return ok
+}
+
+func (c *users) FindByGitHubUsername(name string) *slack.User {
+	if match := c.FindMatch(name); match != nil {
+		return &match.User
+	}
 	return nil
 }
 
+// FindGitHubUsername returns the lower case GitHub username of the Slack user
+// with the given ID, or "" if they haven't set one. Users matched by email are
+// only known once they have been looked up by their GitHub username.
+func (c *users) FindGitHubUsername(slackID string) string {
+	m := c.users.Load()
+	if m == nil {
+		return ""
+	}
+
+	if name, ok := m.byID[slackID]; ok {
+		return name
+	}
+
+	email, ok := m.emails[slackID]
+	if !ok {
+		return ""
+	}
+
+	c.emailMu.Lock()
+	defer c.emailMu.Unlock()
+
+	var found []string
+	for name := range c.emailLogins[email] {
+		found = append(found, name)
+	}
+	sort.Strings(found)
+	if len(found) > 0 {
+		return found[0]
+	}
+	return ""
+}
+
 func findCustomFieldID(team *slack.TeamProfile) string {
 	for _, f := range team.Fields {
 		if strings.Contains(strings.ToLower(f.Label), "github") {
@@ -0,0 +1,465 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/geckoboard/cake-bot/store"
+	"github.com/slack-go/slack"
+)
+
+// fakeSlackAPI serves the team's users, whose GitHub usernames are in the
+// custom profile field Xf01.
+type fakeSlackAPI struct {
+	mu       sync.Mutex
+	members  []map[string]interface{}
+	github   map[string]string
+	failing  map[string]bool
+	profiles []string
+	// fetching is sent the ID of each profile being fetched, which is then
+	// held up until resume is closed, if they aren't nil.
+	fetching chan string
+	resume   chan struct{}
+}
+
+func (f *fakeSlackAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_ = r.ParseForm()
+
+	var body interface{}
+	switch r.URL.Path {
+	case "/team.profile.get":
+		body = map[string]interface{}{"ok": true, "profile": map[string]interface{}{
+			"fields": []map[string]string{{"id": "Xf01", "label": "GitHub"}},
+		}}
+	case "/users.list":
+		body = map[string]interface{}{"ok": true, "members": f.members}
+	case "/users.profile.get":
+		id := r.Form.Get("user")
+		if f.fetching != nil {
+			f.fetching <- id
+			<-f.resume
+		}
+		f.profiles = append(f.profiles, id)
+		if f.failing[id] {
+			body = map[string]interface{}{"ok": false, "error": "ratelimited"}
+			break
+		}
+		body = map[string]interface{}{"ok": true, "profile": map[string]interface{}{
+			"fields": map[string]interface{}{"Xf01": map[string]string{"value": f.github[id]}},
+		}}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (f *fakeSlackAPI) fetched() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fetched := f.profiles
+	f.profiles = nil
+	sort.Strings(fetched)
+	return fetched
+}
+
+func newFakeSlackAPI(t *testing.T, f *fakeSlackAPI) *Client {
+	s := httptest.NewServer(f)
+	t.Cleanup(s.Close)
+	return &Client{api: slack.New("t0ken", slack.OptionAPIURL(s.URL+"/"))}
+}
+
+func member(id string, updated int) map[string]interface{} {
+	return map[string]interface{}{"id": id, "name": id, "updated": updated}
+}
+
+func TestUsersLoadOnlyFetchesUpdatedProfiles(t *testing.T) {
+	f := &fakeSlackAPI{
+		members: []map[string]interface{}{member("U1", 1), member("U2", 1)},
+		github:  map[string]string{"U1": "Alice", "U2": "bob"},
+	}
+	api := newFakeSlackAPI(t, f)
+
+	u := &users{}
+	if err := u.Load(api); err != nil {
+		t.Fatal(err)
+	}
+	if fetched := f.fetched(); len(fetched) != 2 {
+		t.Fatalf("expected every profile to be fetched, got: %v", fetched)
+	}
+
+	f.members = []map[string]interface{}{member("U1", 1), member("U2", 2)}
+	f.github["U2"] = "bobby"
+	if err := u.Load(api); err != nil {
+		t.Fatal(err)
+	}
+	if fetched := f.fetched(); len(fetched) != 1 || fetched[0] != "U2" {
+		t.Fatalf("expected only the updated profile to be fetched, got: %v", fetched)
+	}
+
+	if user := u.FindByGitHubUsername("alice"); user == nil || user.ID != "U1" {
+		t.Errorf("expected alice to be found, got: %v", user)
+	}
+	if user := u.FindByGitHubUsername("bob"); user != nil {
+		t.Errorf("expected bob's old username to be forgotten, got: %v", user)
+	}
+	if name := u.FindGitHubUsername("U2"); name != "bobby" {
+		t.Errorf("expected U2 to be bobby, got: %q", name)
+	}
+}
+
+func TestUsersLoadKeepsUsersWhoseProfilesFail(t *testing.T) {
+	f := &fakeSlackAPI{
+		members: []map[string]interface{}{member("U1", 1), member("U2", 1)},
+		github:  map[string]string{"U1": "alice", "U2": "bob"},
+	}
+	api := newFakeSlackAPI(t, f)
+
+	u := &users{}
+	_ = u.Load(api)
+
+	f.members = []map[string]interface{}{member("U1", 2), member("U2", 1), member("U3", 1)}
+	f.github["U3"] = "carol"
+	f.failing = map[string]bool{"U1": true}
+	if err := u.Load(api); err == nil {
+		t.Error("expected the failed profile to be reported")
+	}
+
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if u.FindByGitHubUsername(name) == nil {
+			t.Errorf("expected %s to be found", name)
+		}
+	}
+
+	// The failed profile is fetched again on the next refresh.
+	f.fetched()
+	f.failing = nil
+	if err := u.Load(api); err != nil {
+		t.Fatal(err)
+	}
+	if fetched := f.fetched(); len(fetched) != 1 || fetched[0] != "U1" {
+		t.Errorf("expected only the failed profile to be fetched again, got: %v", fetched)
+	}
+}
+
+func TestUsersLoadDoesNotHoldUpOverrides(t *testing.T) {
+	f := &fakeSlackAPI{
+		members:  []map[string]interface{}{member("U1", 1)},
+		github:   map[string]string{"U1": "alice"},
+		fetching: make(chan string),
+		resume:   make(chan struct{}),
+	}
+	api := newFakeSlackAPI(t, f)
+
+	u := &users{}
+	loaded := make(chan error)
+	go func() { loaded <- u.Load(api) }()
+	<-f.fetching
+
+	overridden := make(chan struct{})
+	go func() {
+		u.SetOverrides(map[string]string{"alice-bot": "U1"})
+		close(overridden)
+	}()
+	select {
+	case <-overridden:
+	case <-time.After(time.Second):
+		t.Error("expected the overrides to be set while profiles are fetched")
+	}
+	close(f.resume)
+
+	if err := <-loaded; err != nil {
+		t.Fatal(err)
+	}
+	<-overridden
+	if user := u.FindByGitHubUsername("alice-bot"); user == nil || user.ID != "U1" {
+		t.Errorf("expected the overrides set while loading to be used, got: %v", user)
+	}
+}
+
+func TestUsersRestore(t *testing.T) {
+	f := &fakeSlackAPI{
+		members: []map[string]interface{}{member("U1", 1), member("U2", 1)},
+		github:  map[string]string{"U1": "alice", "U2": "bob"},
+	}
+	api := newFakeSlackAPI(t, f)
+	db := store.NewMemory()
+
+	u := &users{}
+	if err := u.Restore(db); err != nil {
+		t.Fatal(err)
+	}
+	_ = u.Load(api)
+
+	// Users that have left are forgotten.
+	f.members = []map[string]interface{}{member("U1", 1)}
+	_ = u.Load(api)
+	f.fetched()
+
+	restarted := &users{}
+	if err := restarted.Restore(db); err != nil {
+		t.Fatal(err)
+	}
+	if user := restarted.FindByGitHubUsername("alice"); user == nil || user.ID != "U1" {
+		t.Errorf("expected alice to be restored, got: %v", user)
+	}
+	if user := restarted.FindByGitHubUsername("bob"); user != nil {
+		t.Errorf("expected bob to be forgotten, got: %v", user)
+	}
+
+	if err := restarted.Load(api); err != nil {
+		t.Fatal(err)
+	}
+	if fetched := f.fetched(); len(fetched) != 0 {
+		t.Errorf("expected no profiles to be fetched after restoring, got: %v", fetched)
+	}
+}
+
+func TestUsersOverrides(t *testing.T) {
+	alice := member("U1", 1)
+	alice["profile"] = map[string]string{"email": "Alice@example.com"}
+	f := &fakeSlackAPI{
+		members: []map[string]interface{}{alice, member("U2", 1)},
+		github:  map[string]string{"U1": "alice", "U2": "bob"},
+	}
+	api := newFakeSlackAPI(t, f)
+
+	u := &users{}
+	u.SetOverrides(map[string]string{
+		"alice-bot": "alice@example.com",
+		"Robert":    "U2",
+		"bob":       "U1",
+		"carol":     "U3",
+	})
+	_ = u.Load(api)
+
+	if user := u.FindByGitHubUsername("alice-bot"); user == nil || user.ID != "U1" {
+		t.Errorf("expected alice-bot to be matched by email, got: %v", user)
+	}
+	if user := u.FindByGitHubUsername("robert"); user == nil || user.ID != "U2" {
+		t.Errorf("expected robert to be matched by ID, got: %v", user)
+	}
+	if user := u.FindByGitHubUsername("bob"); user == nil || user.ID != "U1" {
+		t.Errorf("expected overrides to win over profiles, got: %v", user)
+	}
+	if name := u.FindGitHubUsername("U1"); name != "alice" {
+		t.Errorf("expected U1 to be alice, as in their profile, got: %q", name)
+	}
+	if name := u.FindGitHubUsername("U2"); name != "robert" {
+		t.Errorf("expected U2 to be robert once bob is overridden, got: %q", name)
+	}
+	if unknown := u.UnknownOverrides(); len(unknown) != 1 || unknown[0] != "carol" {
+		t.Errorf("expected carol to be unknown, got: %v", unknown)
+	}
+
+	u.SetOverrides(nil)
+	if user := u.FindByGitHubUsername("alice-bot"); user != nil {
+		t.Errorf("expected overrides to be replaced, got: %v", user)
+	}
+	if unknown := u.UnknownOverrides(); len(unknown) != 0 {
+		t.Errorf("expected no unknown overrides, got: %v", unknown)
+	}
+}
+
+type fakeEmailFinder struct {
+	mu      sync.Mutex
+	emails  map[string][]string
+	err     error
+	lookups []string
+	// block holds up lookups until it is closed, if it isn't nil.
+	block chan struct{}
+}
+
+func (f *fakeEmailFinder) UserEmails(_ context.Context, login string) ([]string, error) {
+	if f.block != nil {
+		<-f.block
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.lookups = append(f.lookups, login)
+	return append([]string(nil), f.emails[login]...), f.err
+}
+
+func (f *fakeEmailFinder) looked() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.lookups...)
+}
+
+func TestUsersMatchByEmail(t *testing.T) {
+	alice := member("U1", 1)
+	alice["profile"] = map[string]string{"email": "alice@example.com"}
+	bob := member("U2", 1)
+	bob["profile"] = map[string]string{"email": "bob@example.com"}
+	f := &fakeSlackAPI{
+		members: []map[string]interface{}{alice, bob},
+		github:  map[string]string{"U2": "bob"},
+	}
+	api := newFakeSlackAPI(t, f)
+
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	finder := &fakeEmailFinder{emails: map[string][]string{
+		"alice": {"alice@old.example", "Alice@example.com"},
+		"bob":   {"alice@example.com"},
+	}}
+
+	u := &users{}
+	u.MatchByEmail(finder, time.Hour)
+	u.now = func() time.Time { return now }
+	_ = u.Load(api)
+	c := context.Background()
+
+	if name := u.FindGitHubUsername("U1"); name != "" {
+		t.Errorf("expected alice to be unknown until looked up, got: %q", name)
+	}
+
+	match := u.AwaitMatch(c, "Alice")
+	if match == nil || match.User.ID != "U1" || match.Source != MatchedByEmail || match.Email != "alice@example.com" {
+		t.Fatalf("expected alice to be matched by email, got: %#v", match)
+	}
+	if match := u.FindMatch("bob"); match == nil || match.User.ID != "U2" || match.Source != MatchedByField {
+		t.Errorf("expected bob to be matched by their profile, got: %#v", match)
+	}
+	if name := u.FindGitHubUsername("U1"); name != "alice" {
+		t.Errorf("expected U1 to be alice once looked up, got: %q", name)
+	}
+	if u.AwaitMatch(c, "carol") != nil {
+		t.Error("expected carol not to be found")
+	}
+
+	// Emails are cached for the TTL.
+	_ = u.AwaitMatch(c, "alice")
+	_ = u.AwaitMatch(c, "carol")
+	if want := []string{"alice", "carol"}; !reflect.DeepEqual(finder.looked(), want) {
+		t.Errorf("expected lookups %v, got: %v", want, finder.looked())
+	}
+
+	// Once expired, emails that can't be looked up keep being used.
+	now = now.Add(time.Hour)
+	finder.err = errors.New("rate limited")
+	if match := u.AwaitMatch(c, "alice"); match == nil || match.User.ID != "U1" {
+		t.Errorf("expected alice to still be matched, got: %#v", match)
+	}
+	now = now.Add(emailRetryAfter / 2)
+	_ = u.AwaitMatch(c, "alice")
+	if len(finder.looked()) != 3 {
+		t.Errorf("expected failed lookups not to be retried straight away, got: %v", finder.looked())
+	}
+
+	// Emails nobody has needed for the TTL are forgotten.
+	u.emailMu.Lock()
+	_, cached := u.emailCache["carol"]
+	u.emailMu.Unlock()
+	if cached {
+		t.Error("expected carol's emails to be forgotten")
+	}
+}
+
+func TestUsersMatchByEmailInBackground(t *testing.T) {
+	alice := member("U1", 1)
+	alice["profile"] = map[string]string{"email": "alice@example.com"}
+	api := newFakeSlackAPI(t, &fakeSlackAPI{members: []map[string]interface{}{alice}})
+
+	finder := &fakeEmailFinder{
+		emails: map[string][]string{"alice": {"alice@example.com"}},
+		block:  make(chan struct{}),
+	}
+
+	u := &users{}
+	u.MatchByEmail(finder, time.Hour)
+	_ = u.Load(api)
+
+	// Lookups don't hold up finding users, and are only made once at a time.
+	for i := 0; i < 3; i++ {
+		if match := u.FindMatch("alice"); match != nil {
+			t.Fatalf("expected alice not to be found while looking her up, got: %#v", match)
+		}
+	}
+	close(finder.block)
+
+	if match := u.AwaitMatch(context.Background(), "alice"); match == nil || match.User.ID != "U1" {
+		t.Fatalf("expected alice to be found once looked up, got: %#v", match)
+	}
+	if lookups := finder.looked(); len(lookups) != 1 {
+		t.Errorf("expected a single lookup, got: %v", lookups)
+	}
+}
+
+func TestUsersMatchByEmailSkipsBotsAndOverrides(t *testing.T) {
+	api := newFakeSlackAPI(t, &fakeSlackAPI{members: []map[string]interface{}{member("U1", 1)}})
+	finder := &fakeEmailFinder{}
+
+	u := &users{}
+	u.MatchByEmail(finder, time.Hour)
+	u.SetOverrides(map[string]string{"Alice": "U404"})
+	_ = u.Load(api)
+	c := context.Background()
+
+	_ = u.AwaitMatch(c, "dependabot[bot]")
+	_ = u.AwaitMatch(c, "alice")
+	if lookups := finder.looked(); len(lookups) != 0 {
+		t.Errorf("expected bots and overridden users not to be looked up, got: %v", lookups)
+	}
+}
+
+// rateLimitedError is what GitHub's client returns once it is rate limited.
+type rateLimitedError struct{}
+
+func (rateLimitedError) Error() string     { return "github: 429 rate limited" }
+func (rateLimitedError) RateLimited() bool { return true }
+
+func TestUsersMatchByEmailBacksOff(t *testing.T) {
+	api := newFakeSlackAPI(t, &fakeSlackAPI{members: []map[string]interface{}{member("U1", 1)}})
+	finder := &fakeEmailFinder{err: errors.New("timeout")}
+
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	u := &users{}
+	u.MatchByEmail(finder, time.Hour)
+	u.now = func() time.Time { return now }
+	_ = u.Load(api)
+	c := context.Background()
+
+	// Each failure doubles the time until the next lookup.
+	_ = u.AwaitMatch(c, "alice")
+	now = now.Add(emailRetryAfter)
+	_ = u.AwaitMatch(c, "alice")
+	now = now.Add(emailRetryAfter)
+	_ = u.AwaitMatch(c, "alice")
+	if lookups := finder.looked(); len(lookups) != 2 {
+		t.Fatalf("expected the second failure to be retried later, got: %v", lookups)
+	}
+	now = now.Add(emailRetryAfter)
+	_ = u.AwaitMatch(c, "alice")
+	if lookups := finder.looked(); len(lookups) != 3 {
+		t.Fatalf("expected the lookup to be retried, got: %v", lookups)
+	}
+
+	// Once rate limited, nobody is looked up until it is retried.
+	finder.err = rateLimitedError{}
+	now = now.Add(4 * emailRetryAfter)
+	_ = u.AwaitMatch(c, "alice")
+	_ = u.AwaitMatch(c, "bob")
+	if lookups := finder.looked(); len(lookups) != 4 {
+		t.Fatalf("expected lookups to pause once rate limited, got: %v", lookups)
+	}
+	now = now.Add(8 * emailRetryAfter)
+	_ = u.AwaitMatch(c, "bob")
+	if lookups := finder.looked(); len(lookups) != 5 || lookups[4] != "bob" {
+		t.Errorf("expected lookups to resume, got: %v", lookups)
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/geckoboard/cake-bot/ctx"
+	"github.com/geckoboard/cake-bot/github"
+	"github.com/geckoboard/cake-bot/store"
+)
+
+// ReviewStat records a review, which is a cake when it approves the pull
+// request.
+type ReviewStat struct {
+	Repository  string    `json:"repository"`
+	PullRequest int       `json:"pull_request"`
+	Reviewer    string    `json:"reviewer"`
+	Author      string    `json:"author"`
+	State       string    `json:"state"`
+	SubmittedAt time.Time `json:"submitted_at"`
+
+	// ReviewID is the GitHub review, which a dismissal refers to. It isn't
+	// set on reviews recorded before dismissals were.
+	ReviewID int `json:"review_id,omitempty"`
+
+	// TimeToFirstReview is how long the reviewer took to first review the
+	// pull request after being asked to. It is only set on the first
+	// review of a request that Cake Bot notified about.
+	TimeToFirstReview time.Duration `json:"time_to_first_review,omitempty"`
+}
+
+// IsCake reports whether the review approved the pull request.
+func (s ReviewStat) IsCake() bool {
+	return s.State == "approved"
+}
+
+// IsDismissal reports whether the stat records that the review was dismissed,
+// rather than the review itself.
+func (s ReviewStat) IsDismissal() bool {
+	return s.State == "dismissed"
+}
+
+// StatsStore keeps the reviews that have been recorded.
+type StatsStore interface {
+	Add(ReviewStat) error
+	// List returns the reviews submitted since the given time, oldest
+	// first.
+	List(since time.Time) ([]ReviewStat, error)
+}
+
+// StoreStatsStore is a StatsStore kept in the stats bucket of a store.Store.
+type StoreStatsStore struct {
+	store store.Store
+}
+
+func NewStoreStatsStore(s store.Store) *StoreStatsStore {
+	return &StoreStatsStore{store: s}
+}
+
+// statKey keys reviews by when they were submitted, so that they are scanned
+// oldest first and from a given time. A dismissal is keyed next to the review
+// it dismisses.
+func statKey(stat ReviewStat) string {
+	return fmt.Sprintf("%s|%s#%d|%s|%s",
+		store.TimeKey(stat.SubmittedAt),
+		stat.Repository, stat.PullRequest, strings.ToLower(stat.Reviewer), stat.State,
+	)
+}
+
+func (s *StoreStatsStore) Add(stat ReviewStat) error {
+	return store.PutJSON(s.store, store.Stats, statKey(stat), stat)
+}
+
+func (s *StoreStatsStore) List(since time.Time) ([]ReviewStat, error) {
+	var stats []ReviewStat
+	err := s.store.ScanFrom(store.Stats, store.TimeKey(since), func(_ string, value []byte) error {
+		var stat ReviewStat
+		if err := json.Unmarshal(value, &stat); err != nil {
+			return err
+		}
+		stats = append(stats, stat)
+		return nil
+	})
+	return stats, err
+}
+
+// StatsRecorder is a Notifier that records every review it notifies about.
+// It must wrap the ReminderTracker, so that it sees when the review was
+// requested before the tracker forgets about it.
+type StatsRecorder struct {
+	Notifier
+	pending ReminderStore
+	stats   StatsStore
+	now     func() time.Time
+}
+
+func NewStatsRecorder(notifier Notifier, pending ReminderStore, stats StatsStore) *StatsRecorder {
+	return &StatsRecorder{Notifier: notifier, pending: pending, stats: stats, now: time.Now}
+}
+
+func (r *StatsRecorder) Approved(c context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review) error {
+	r.record(c, repo, pr, review)
+	return r.Notifier.Approved(c, repo, pr, review)
+}
+
+func (r *StatsRecorder) ChangesRequested(c context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review) error {
+	r.record(c, repo, pr, review)
+	return r.Notifier.ChangesRequested(c, repo, pr, review)
+}
+
+func (r *StatsRecorder) Commented(c context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review) error {
+	r.record(c, repo, pr, review)
+	return r.Notifier.Commented(c, repo, pr, review)
+}
+
+// ReviewDismissed records the dismissal, so that a dismissed approval isn't
+// counted as a cake.
+func (r *StatsRecorder) ReviewDismissed(c context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review, sender *github.User) error {
+	if err := r.stats.Add(r.reviewStat(repo, pr, review, "dismissed")); err != nil {
+		ctx.Logger(c).Error("at", "stats_store_error", "err", err)
+	}
+	return r.Notifier.ReviewDismissed(c, repo, pr, review, sender)
+}
+
+// reviewStat returns the stat of the review in the given state. It is dated
+// when the review was submitted, so that a dismissal is listed along with the
+// review it dismisses.
+func (r *StatsRecorder) reviewStat(repo *github.Repository, pr *github.PullRequest, review *github.Review, state string) ReviewStat {
+	stat := ReviewStat{
+		Repository:  repo.FullName,
+		PullRequest: pr.Number,
+		Reviewer:    review.User.Login,
+		State:       state,
+		SubmittedAt: review.SubmittedAt,
+		ReviewID:    review.ID,
+	}
+	if pr.User != nil {
+		stat.Author = pr.User.Login
+	}
+	if stat.SubmittedAt.IsZero() {
+		stat.SubmittedAt = r.now()
+	}
+	return stat
+}
+
+func (r *StatsRecorder) record(c context.Context, repo *github.Repository, pr *github.PullRequest, review *github.Review) {
+	stat := r.reviewStat(repo, pr, review, review.State)
+
+	pending, err := r.pending.Get(pullRequestKey(repo, pr), review.User.Login)
+	if err != nil {
+		ctx.Logger(c).Error("at", "reminder_store_error", "err", err)
+	}
+	if pending != nil && stat.SubmittedAt.After(pending.RequestedAt) {
+		stat.TimeToFirstReview = stat.SubmittedAt.Sub(pending.RequestedAt)
+	}
+
+	if err := r.stats.Add(stat); err != nil {
+		ctx.Logger(c).Error("at", "stats_store_error", "err", err)
+	}
+}
+
+// leaderboardSize is how many people or pull requests each leaderboard lists.
+const leaderboardSize = 5
+
+// Leaderboard celebrates the reviewers of a period, and shows the pull
+// requests that are still waiting for a review.
+type Leaderboard struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+
+	Reviews int `json:"reviews"`
+	Cakes   int `json:"cakes"`
+
+	// MostCakes are the reviewers that approved the most pull requests.
+	MostCakes []ReviewerCount `json:"most_cakes"`
+	// Fastest are the reviewers with the shortest median time to first
+	// review.
+	Fastest []ReviewerTime `json:"fastest"`
+	// Waiting are the review requests that have been pending the longest,
+	// one per pull request.
+	Waiting []PendingReview `json:"waiting"`
+}
+
+type ReviewerCount struct {
+	Reviewer string `json:"reviewer"`
+	Count    int    `json:"count"`
+}
+
+type ReviewerTime struct {
+	Reviewer string `json:"reviewer"`
+	Reviews  int    `json:"reviews"`
+	// Median is the median time to first review.
+	Median time.Duration `json:"median"`
+}
+
+// Stats builds leaderboards from the recorded and pending reviews.
+type Stats struct {
+	stats   StatsStore
+	pending ReminderStore
+	now     func() time.Time
+}
+
+func NewStats(stats StatsStore, pending ReminderStore) *Stats {
+	return &Stats{stats: stats, pending: pending, now: time.Now}
+}
+
+// Leaderboard returns the leaderboard for the reviews submitted since the
+// given time.
+func (s *Stats) Leaderboard(since time.Time) (*Leaderboard, error) {
+	stats, err := s.stats.List(since)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := s.pending.List()
+	if err != nil {
+		return nil, err
+	}
+	return buildLeaderboard(stats, pending, since, s.now()), nil
+}
+
+func buildLeaderboard(stats []ReviewStat, pending []PendingReview, since, until time.Time) *Leaderboard {
+	board := &Leaderboard{Since: since, Until: until}
+
+	dismissed := map[int]bool{}
+	for _, stat := range stats {
+		if stat.IsDismissal() && stat.ReviewID != 0 {
+			dismissed[stat.ReviewID] = true
+		}
+	}
+
+	var (
+		cakes = map[string]int{}
+		times = map[string][]time.Duration{}
+		names = map[string]string{}
+	)
+	for _, stat := range stats {
+		if stat.IsDismissal() {
+			continue
+		}
+		board.Reviews++
+
+		key := strings.ToLower(stat.Reviewer)
+		names[key] = stat.Reviewer
+
+		if stat.IsCake() && !dismissed[stat.ReviewID] {
+			board.Cakes++
+			cakes[key]++
+		}
+		if stat.TimeToFirstReview > 0 {
+			times[key] = append(times[key], stat.TimeToFirstReview)
+		}
+	}
+
+	for key, count := range cakes {
+		board.MostCakes = append(board.MostCakes, ReviewerCount{Reviewer: names[key], Count: count})
+	}
+	sort.Slice(board.MostCakes, func(i, j int) bool {
+		a, b := board.MostCakes[i], board.MostCakes[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Reviewer < b.Reviewer
+	})
+	board.MostCakes = board.MostCakes[:min(len(board.MostCakes), leaderboardSize)]
+
+	for key, durations := range times {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		board.Fastest = append(board.Fastest, ReviewerTime{Reviewer: names[key], Reviews: len(durations), Median: durations[len(durations)/2]})
+	}
+	sort.Slice(board.Fastest, func(i, j int) bool {
+		a, b := board.Fastest[i], board.Fastest[j]
+		if a.Median != b.Median {
+			return a.Median < b.Median
+		}
+		return a.Reviewer < b.Reviewer
+	})
+	board.Fastest = board.Fastest[:min(len(board.Fastest), leaderboardSize)]
+
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].RequestedAt.Before(pending[j].RequestedAt) })
+	seen := map[PullRequestKey]bool{}
+	for _, review := range pending {
+		if len(board.Waiting) == leaderboardSize {
+			break
+		}
+		if !seen[review.Key()] {
+			seen[review.Key()] = true
+			board.Waiting = append(board.Waiting, review)
+		}
+	}
+	return board
+}
+
+// LeaderboardNotifier posts leaderboards.
+type LeaderboardNotifier interface {
+	Leaderboard(c context.Context, channel string, board *Leaderboard) error
+}
+
+// PostLeaderboard posts the leaderboard of the last week to the channels.
+func (s *Stats) PostLeaderboard(c context.Context, notifier LeaderboardNotifier, channels []string) error {
+	board, err := s.Leaderboard(s.now().AddDate(0, 0, -7))
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, channel := range channels {
+		if err := notifier.Leaderboard(c, channel, board); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
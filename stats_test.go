@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/geckoboard/cake-bot/github"
+	"github.com/geckoboard/cake-bot/store"
+)
+
+func TestStatsRecorderRecordsTimeToFirstReview(t *testing.T) {
+	pending := NewStoreReminderStore(store.NewMemory())
+	stats := NewStoreStatsStore(store.NewMemory())
+	recorder := NewStatsRecorder(NewReminderTracker(&fakeNotifier{}, pending), pending, stats)
+	c := context.Background()
+
+	requestedAt := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	_ = pending.Put(PendingReview{Repository: testRepo, PullRequest: testPR, Reviewer: testReview.User, RequestedAt: requestedAt})
+
+	commented := &github.Review{User: testReview.User, State: "commented", SubmittedAt: requestedAt.Add(90 * time.Minute)}
+	approved := &github.Review{User: testReview.User, State: "approved", SubmittedAt: requestedAt.Add(3 * time.Hour)}
+	_ = recorder.Commented(c, testRepo, testPR, commented)
+	_ = recorder.Approved(c, testRepo, testPR, approved)
+
+	recorded, _ := stats.List(time.Time{})
+	if len(recorded) != 2 {
+		t.Fatalf("expected 2 reviews to be recorded, got: %#v", recorded)
+	}
+	if r := recorded[0]; r.TimeToFirstReview != 90*time.Minute || r.Reviewer != "reviewer" || r.Author != "author" || r.Repository != "geckoboard/cake-bot" {
+		t.Errorf("unexpected first review: %#v", r)
+	}
+	if r := recorded[1]; !r.IsCake() || r.TimeToFirstReview != 0 {
+		t.Errorf("expected a cake without a time to first review, got: %#v", r)
+	}
+}
+
+func TestStatsRecorderDoesNotCountDismissedApprovals(t *testing.T) {
+	pending := NewStoreReminderStore(store.NewMemory())
+	stats := NewStoreStatsStore(store.NewMemory())
+	recorder := NewStatsRecorder(&fakeNotifier{}, pending, stats)
+	c := context.Background()
+
+	submittedAt := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	approved := &github.Review{ID: 3, User: testReview.User, State: "approved", SubmittedAt: submittedAt}
+	dismissed := &github.Review{ID: 3, User: testReview.User, State: "dismissed", SubmittedAt: submittedAt}
+	_ = recorder.Approved(c, testRepo, testPR, approved)
+	_ = recorder.ReviewDismissed(c, testRepo, testPR, dismissed, testPR.User)
+
+	board, err := NewStats(stats, pending).Leaderboard(submittedAt.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if board.Reviews != 1 || board.Cakes != 0 || len(board.MostCakes) != 0 {
+		t.Errorf("expected the dismissed approval to be a review but not a cake, got: %#v", board)
+	}
+}
+
+func TestBuildLeaderboard(t *testing.T) {
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	stats := []ReviewStat{
+		{Reviewer: "alice", State: "approved", TimeToFirstReview: 3 * time.Hour},
+		{Reviewer: "alice", State: "approved", TimeToFirstReview: time.Hour},
+		{Reviewer: "Alice", State: "approved", TimeToFirstReview: 2 * time.Hour},
+		{Reviewer: "bob", State: "approved", TimeToFirstReview: 30 * time.Minute},
+		{Reviewer: "carol", State: "changes_requested"},
+	}
+	older := &github.PullRequest{Number: 13}
+	pending := []PendingReview{
+		{Repository: testRepo, PullRequest: testPR, Reviewer: &github.User{Login: "bob"}, RequestedAt: since.Add(2 * time.Hour)},
+		{Repository: testRepo, PullRequest: older, Reviewer: &github.User{Login: "bob"}, RequestedAt: since},
+		{Repository: testRepo, PullRequest: older, Reviewer: &github.User{Login: "carol"}, RequestedAt: since.Add(time.Hour)},
+	}
+
+	board := buildLeaderboard(stats, pending, since, since.AddDate(0, 0, 7))
+
+	if board.Reviews != 5 || board.Cakes != 4 {
+		t.Errorf("expected 5 reviews and 4 cakes, got %d and %d", board.Reviews, board.Cakes)
+	}
+	if len(board.MostCakes) != 2 || board.MostCakes[0].Count != 3 || board.MostCakes[1].Reviewer != "bob" {
+		t.Errorf("unexpected most cakes: %#v", board.MostCakes)
+	}
+	if len(board.Fastest) != 2 || board.Fastest[0].Reviewer != "bob" || board.Fastest[1].Median != 2*time.Hour {
+		t.Errorf("unexpected fastest reviewers: %#v", board.Fastest)
+	}
+	if len(board.Waiting) != 2 || board.Waiting[0].PullRequest.Number != 13 || board.Waiting[1].PullRequest.Number != 12 {
+		t.Errorf("expected one waiting review per pull request, oldest first, got: %#v", board.Waiting)
+	}
+}
+
+func TestStoreStatsStoreListsSince(t *testing.T) {
+	testStatsStoreListsSince(t, NewStoreStatsStore(store.NewMemory()))
+}
+
+func testStatsStoreListsSince(t *testing.T, store StatsStore) {
+	t.Helper()
+
+	since := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+	for _, at := range []time.Time{since.Add(time.Hour), since.Add(-time.Hour), since} {
+		if err := store.Add(ReviewStat{Reviewer: "alice", State: "approved", SubmittedAt: at}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := store.List(since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 || !stats[0].SubmittedAt.Equal(since) || !stats[1].SubmittedAt.Equal(since.Add(time.Hour)) {
+		t.Errorf("expected the reviews since %s, oldest first, got: %#v", since, stats)
+	}
+}
@@ -0,0 +1,211 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// metaBucket holds the schema version, under versionKey.
+const metaBucket = "meta"
+
+var versionKey = []byte("version")
+
+// migration changes the schema of a Bolt store from the previous version.
+type migration struct {
+	Description string
+	Up          func(tx *bolt.Tx) error
+}
+
+// migrations are applied in order to bring a Bolt store up to date, and the
+// schema version is how many have been applied. Only ever add to the end.
+var migrations = []migration{
+	{
+		Description: "create the buckets",
+		Up:          createBuckets(PullRequests, ReviewRequests, Deliveries, Stats),
+	},
+	{
+		Description: "create the Slack users bucket",
+		Up:          createBuckets(SlackUsers),
+	},
+	{
+		Description: "create the dead letters bucket",
+		Up:          createBuckets(DeadLetters),
+	},
+	{
+		Description: "create the held messages bucket",
+		Up:          createBuckets(HeldMessages),
+	},
+}
+
+// buckets are every bucket that migrations create.
+var buckets = []string{PullRequests, ReviewRequests, Deliveries, Stats, SlackUsers, DeadLetters, HeldMessages}
+
+func createBuckets(names ...string) func(tx *bolt.Tx) error {
+	return func(tx *bolt.Tx) error {
+		for _, name := range names {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Bolt is a Store kept in a single file with BoltDB.
+type Bolt struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens the Bolt store in the file at path, creating it if needed,
+// and migrates it to the latest schema. Only one process can have it open.
+func OpenBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrate(db, migrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Bolt{db: db}, nil
+}
+
+// migrate applies the migrations that haven't been yet, each in a transaction
+// of its own.
+func migrate(db *bolt.DB, migrations []migration) error {
+	version, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("store: schema version %d is newer than this version of cake-bot supports (%d)", version, len(migrations))
+	}
+
+	for i := version; i < len(migrations); i++ {
+		err := db.Update(func(tx *bolt.Tx) error {
+			if err := migrations[i].Up(tx); err != nil {
+				return err
+			}
+
+			meta, err := tx.CreateBucketIfNotExists([]byte(metaBucket))
+			if err != nil {
+				return err
+			}
+			return meta.Put(versionKey, binary.BigEndian.AppendUint64(nil, uint64(i+1)))
+		})
+		if err != nil {
+			return fmt.Errorf("store: migration %d (%s) failed: %w", i+1, migrations[i].Description, err)
+		}
+	}
+	return nil
+}
+
+// schemaVersion returns how many migrations have been applied to the store.
+func schemaVersion(db *bolt.DB) (int, error) {
+	var version int
+	err := db.View(func(tx *bolt.Tx) error {
+		if meta := tx.Bucket([]byte(metaBucket)); meta != nil {
+			if v := meta.Get(versionKey); len(v) == 8 {
+				version = int(binary.BigEndian.Uint64(v))
+			}
+		}
+		return nil
+	})
+	return version, err
+}
+
+func (s *Bolt) Get(bucket, key string) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return ErrUnknownBucket
+		}
+		// Values are only valid during the transaction.
+		value = clone(b.Get([]byte(key)))
+		return nil
+	})
+	return value, err
+}
+
+func (s *Bolt) Put(bucket, key string, value []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return ErrUnknownBucket
+		}
+		return b.Put([]byte(key), value)
+	})
+}
+
+func (s *Bolt) Delete(bucket, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return ErrUnknownBucket
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+func (s *Bolt) Update(bucket, key string, fn func(value []byte) ([]byte, error)) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return ErrUnknownBucket
+		}
+
+		value, err := fn(clone(b.Get([]byte(key))))
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			return b.Delete([]byte(key))
+		}
+		return b.Put([]byte(key), value)
+	})
+}
+
+func (s *Bolt) Scan(bucket, prefix string, fn func(key string, value []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return ErrUnknownBucket
+		}
+
+		c := b.Cursor()
+		p := []byte(prefix)
+		for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+			if err := fn(string(k), clone(v)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Bolt) ScanFrom(bucket, start string, fn func(key string, value []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return ErrUnknownBucket
+		}
+
+		c := b.Cursor()
+		for k, v := c.Seek([]byte(start)); k != nil; k, v = c.Next() {
+			if err := fn(string(k), clone(v)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Bolt) Close() error {
+	return s.db.Close()
+}
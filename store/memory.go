@@ -0,0 +1,139 @@
+package store
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Memory is a Store that is lost when cake-bot restarts.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]map[string][]byte
+}
+
+// NewMemory instantiates a Memory store with every bucket.
+func NewMemory() *Memory {
+	m := &Memory{buckets: make(map[string]map[string][]byte)}
+	for _, name := range buckets {
+		m.buckets[name] = make(map[string][]byte)
+	}
+	return m
+}
+
+func (m *Memory) Get(bucket, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[bucket]
+	if !ok {
+		return nil, ErrUnknownBucket
+	}
+	return clone(b[key]), nil
+}
+
+func (m *Memory) Put(bucket, key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[bucket]
+	if !ok {
+		return ErrUnknownBucket
+	}
+	b[key] = clone(value)
+	return nil
+}
+
+func (m *Memory) Delete(bucket, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[bucket]
+	if !ok {
+		return ErrUnknownBucket
+	}
+	delete(b, key)
+	return nil
+}
+
+func (m *Memory) Update(bucket, key string, fn func(value []byte) ([]byte, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[bucket]
+	if !ok {
+		return ErrUnknownBucket
+	}
+
+	value, err := fn(clone(b[key]))
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		delete(b, key)
+	} else {
+		b[key] = clone(value)
+	}
+	return nil
+}
+
+func (m *Memory) Scan(bucket, prefix string, fn func(key string, value []byte) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[bucket]
+	if !ok {
+		return ErrUnknownBucket
+	}
+
+	var keys []string
+	for key := range b {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := fn(key, clone(b[key])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Memory) ScanFrom(bucket, start string, fn func(key string, value []byte) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[bucket]
+	if !ok {
+		return ErrUnknownBucket
+	}
+
+	var keys []string
+	for key := range b {
+		if key >= start {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := fn(key, clone(b[key])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+func clone(value []byte) []byte {
+	if value == nil {
+		return nil
+	}
+	return append([]byte{}, value...)
+}
@@ -0,0 +1,102 @@
+// Package store keeps what cake-bot knows about pull requests and reviews, so
+// that it survives restarts.
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// The buckets that documents are kept in.
+const (
+	// PullRequests holds the Slack messages posted about each pull request.
+	PullRequests = "pull_requests"
+	// ReviewRequests holds the review requests that are still pending.
+	ReviewRequests = "review_requests"
+	// Deliveries holds the IDs of the GitHub deliveries already handled.
+	Deliveries = "deliveries"
+	// Stats holds every review that has been recorded.
+	Stats = "stats"
+	// SlackUsers holds the Slack profiles last fetched, by Slack user ID.
+	SlackUsers = "slack_users"
+	// DeadLetters holds the notifications that couldn't be delivered to
+	// Slack, by when they failed.
+	DeadLetters = "dead_letters"
+	// HeldMessages holds the direct messages held until their recipients
+	// are next working, by when they are due.
+	HeldMessages = "held_messages"
+)
+
+// ErrUnknownBucket is returned when using a bucket that doesn't exist.
+var ErrUnknownBucket = errors.New("store: unknown bucket")
+
+// Store keeps documents in buckets, by key. Implementations are safe for
+// concurrent use.
+type Store interface {
+	// Get returns the document stored under key, or nil if there isn't one.
+	Get(bucket, key string) ([]byte, error)
+	Put(bucket, key string, value []byte) error
+	Delete(bucket, key string) error
+
+	// Update replaces the document stored under key, which is nil if there
+	// isn't one, with the one fn returns. The document is deleted if fn
+	// returns nil, and left alone if fn returns an error. Nothing else can
+	// change the document in the meantime, and fn must not use the Store.
+	Update(bucket, key string, fn func(value []byte) ([]byte, error)) error
+
+	// Scan calls fn with each document whose key starts with prefix, in key
+	// order, until fn returns an error. fn must not use the Store.
+	Scan(bucket, prefix string, fn func(key string, value []byte) error) error
+
+	// ScanFrom calls fn with each document whose key sorts at or after
+	// start, in key order, until fn returns an error. fn must not use the
+	// Store.
+	ScanFrom(bucket, start string, fn func(key string, value []byte) error) error
+
+	Close() error
+}
+
+// GetJSON decodes the document stored under key into v, and reports whether
+// there was one.
+func GetJSON(s Store, bucket, key string, v interface{}) (bool, error) {
+	value, err := s.Get(bucket, key)
+	if err != nil || value == nil {
+		return false, err
+	}
+	return true, json.Unmarshal(value, v)
+}
+
+// PutJSON stores v encoded as JSON under key.
+func PutJSON(s Store, bucket, key string, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.Put(bucket, key, value)
+}
+
+// UpdateJSON decodes the document stored under key into v, which is left
+// alone if there isn't one, and stores v once fn has changed it. The document
+// is deleted if fn returns false.
+func UpdateJSON(s Store, bucket, key string, v interface{}, fn func(exists bool) (keep bool, err error)) error {
+	return s.Update(bucket, key, func(value []byte) ([]byte, error) {
+		if value != nil {
+			if err := json.Unmarshal(value, v); err != nil {
+				return nil, err
+			}
+		}
+
+		keep, err := fn(value != nil)
+		if err != nil || !keep {
+			return nil, err
+		}
+		return json.Marshal(v)
+	})
+}
+
+// TimeKey formats t so that keys starting with it sort in time order, e.g. to
+// scan documents from a given time with ScanFrom.
+func TimeKey(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000000Z")
+}
@@ -0,0 +1,147 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func openBolt(t *testing.T, path string) *Bolt {
+	t.Helper()
+
+	s, err := OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store { return NewMemory() },
+		"bolt": func(t *testing.T) Store {
+			s := openBolt(t, filepath.Join(t.TempDir(), "cake-bot.db"))
+			t.Cleanup(func() { s.Close() })
+			return s
+		},
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			s := open(t)
+
+			for _, bucket := range buckets {
+				if _, err := s.Get(bucket, "missing"); err != nil {
+					t.Errorf("expected bucket %s to exist, got: %v", bucket, err)
+				}
+			}
+			if err := s.Put("missing", "key", []byte("{}")); !errors.Is(err, ErrUnknownBucket) {
+				t.Errorf("expected ErrUnknownBucket, got: %v", err)
+			}
+
+			type doc struct {
+				Count int `json:"count"`
+			}
+			for _, key := range []string{"a#1|x", "a#12|x", "a#1|y", "b#1|x"} {
+				if err := PutJSON(s, ReviewRequests, key, doc{Count: 1}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var keys []string
+			_ = s.Scan(ReviewRequests, "a#1|", func(key string, _ []byte) error {
+				keys = append(keys, key)
+				return nil
+			})
+			if !reflect.DeepEqual(keys, []string{"a#1|x", "a#1|y"}) {
+				t.Errorf("unexpected keys scanned: %v", keys)
+			}
+
+			keys = nil
+			_ = s.ScanFrom(ReviewRequests, "a#1|y", func(key string, _ []byte) error {
+				keys = append(keys, key)
+				return nil
+			})
+			if !reflect.DeepEqual(keys, []string{"a#1|y", "b#1|x"}) {
+				t.Errorf("unexpected keys scanned from a#1|y: %v", keys)
+			}
+
+			var d doc
+			err := UpdateJSON(s, ReviewRequests, "a#1|x", &d, func(exists bool) (bool, error) {
+				d.Count++
+				return exists, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok, _ := GetJSON(s, ReviewRequests, "a#1|x", &d); !ok || d.Count != 2 {
+				t.Errorf("expected the document to be updated, got: %#v", d)
+			}
+
+			err = UpdateJSON(s, ReviewRequests, "a#1|x", &d, func(bool) (bool, error) { return false, nil })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value, _ := s.Get(ReviewRequests, "a#1|x"); value != nil {
+				t.Errorf("expected the document to be deleted, got: %s", value)
+			}
+
+			if err := s.Delete(ReviewRequests, "b#1|x"); err != nil {
+				t.Fatal(err)
+			}
+			if value, _ := s.Get(ReviewRequests, "b#1|x"); value != nil {
+				t.Errorf("expected the document to be deleted, got: %s", value)
+			}
+		})
+	}
+}
+
+func TestBoltSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cake-bot.db")
+
+	s := openBolt(t, path)
+	if err := s.Put(Stats, "key", []byte(`{"reviewer":"alice"}`)); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s = openBolt(t, path)
+	defer s.Close()
+
+	if value, _ := s.Get(Stats, "key"); string(value) != `{"reviewer":"alice"}` {
+		t.Errorf("expected the document to be kept, got: %s", value)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "cake-bot.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var applied []string
+	step := func(name string) migration {
+		return migration{Description: name, Up: func(tx *bolt.Tx) error {
+			applied = append(applied, name)
+			return nil
+		}}
+	}
+
+	if err := migrate(db, []migration{step("one")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(db, []migration{step("one"), step("two")}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(applied, []string{"one", "two"}) {
+		t.Errorf("expected each migration to be applied once, got: %v", applied)
+	}
+
+	if err := migrate(db, []migration{step("one")}); err == nil {
+		t.Error("expected a newer schema to be refused")
+	}
+}
@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"crypto/hmac"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // WebhookValidator interface validates the incoming webhook request.
@@ -17,50 +21,151 @@ type WebhookValidator interface {
 }
 
 // GitHubWebhookValidator implements the validation of GitHub webhook requests
-// using a secret key.
+// using one or more secret keys.
 type GitHubWebhookValidator struct {
-	secret string
+	secrets   []string
+	allowSHA1 bool
 }
 
 // NewGitHubWebhookValidator instantiates a new GitHubWebhookValidator given the
-// secret key.
-func NewGitHubWebhookValidator(secret string) *GitHubWebhookValidator {
-	return &GitHubWebhookValidator{secret}
+// accepted secret keys. Accepting several secrets allows a secret to be rotated
+// without rejecting webhooks signed with the previous one. allowSHA1 controls
+// whether the legacy X-Hub-Signature header is accepted when no SHA-256
+// signature is provided.
+func NewGitHubWebhookValidator(secrets []string, allowSHA1 bool) *GitHubWebhookValidator {
+	return &GitHubWebhookValidator{secrets: secrets, allowSHA1: allowSHA1}
 }
 
 // GitHubWebhookValidator implements the WebhookValidator interface.
-// The implementation uses HMAC encryption-decryption using the "secret" key.
+// The implementation uses HMAC encryption-decryption using the "secret" keys,
+// preferring the X-Hub-Signature-256 header over the legacy SHA-1 one.
 //
-// Refer: https://developer.github.com/webhooks/securing/#securing-your-webhooks
+// Refer: https://docs.github.com/en/webhooks/using-webhooks/validating-webhook-deliveries
 func (g *GitHubWebhookValidator) ValidateSignature(r *http.Request) error {
-	signature := r.Header.Get("X-Hub-Signature")
+	prefix, hashFunc := "sha256", sha256.New
+	signature := r.Header.Get("X-Hub-Signature-256")
+
+	if signature == "" {
+		if legacy := r.Header.Get("X-Hub-Signature"); legacy != "" {
+			if !g.allowSHA1 {
+				return errors.New("SHA-1 signatures are not accepted")
+			}
+			prefix, hashFunc, signature = "sha1", sha1.New, legacy
+		}
+	}
+
 	if signature == "" {
 		return errors.New("No signature header provided")
 	}
 
-	// The value of the header is of the format: sha1=<actualhash>
+	// The value of the header is of the format: <prefix>=<actualhash>
 	gotHash := strings.SplitN(signature, "=", 2)
-	if gotHash[0] != "sha1" {
+	if len(gotHash) != 2 || gotHash[0] != prefix {
 		return errors.New("Invalid signature header provided")
 	}
-	defer r.Body.Close()
 
-	b, err := io.ReadAll(r.Body)
+	got, err := hex.DecodeString(gotHash[1])
 	if err != nil {
-		return err
+		return errors.New("Invalid signature header provided")
 	}
 
 	// Enable re-reading of the request body post validation
-	r.Body = io.NopCloser(bytes.NewReader(b))
+	b, err := readBody(r)
+	if err != nil {
+		return err
+	}
+
+	for _, secret := range g.secrets {
+		hash := hmac.New(hashFunc, []byte(secret))
+		if _, err := hash.Write(b); err != nil {
+			return err
+		}
+
+		if hmac.Equal(hash.Sum(nil), got) {
+			return nil
+		}
+	}
+	return errors.New("Hashes do not match")
+}
+
+// DefaultSlackRequestMaxAge is how old a Slack request timestamp may be before
+// the request is considered a replay.
+const DefaultSlackRequestMaxAge = 5 * time.Minute
+
+// SlackRequestValidator implements the validation of requests sent by Slack
+// (interactions, slash commands) using the app's signing secret.
+type SlackRequestValidator struct {
+	secret string
+	maxAge time.Duration
+	now    func() time.Time
+}
+
+// NewSlackRequestValidator instantiates a new SlackRequestValidator given the
+// signing secret. Requests older than maxAge are rejected.
+func NewSlackRequestValidator(secret string, maxAge time.Duration) *SlackRequestValidator {
+	return &SlackRequestValidator{secret: secret, maxAge: maxAge, now: time.Now}
+}
+
+// ValidateSignature implements the WebhookValidator interface.
+// The signature is a HMAC-SHA256 of "v0:<timestamp>:<body>" using the signing
+// secret, and the timestamp must fall within the replay window.
+//
+// Refer: https://api.slack.com/authentication/verifying-requests-from-slack
+func (s *SlackRequestValidator) ValidateSignature(r *http.Request) error {
+	signature := r.Header.Get("X-Slack-Signature")
+	if signature == "" {
+		return errors.New("No signature header provided")
+	}
+
+	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+	if timestamp == "" {
+		return errors.New("No request timestamp header provided")
+	}
+
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("Invalid request timestamp header provided")
+	}
+
+	age := s.now().Sub(time.Unix(secs, 0))
+	if age > s.maxAge || age < -s.maxAge {
+		return errors.New("Request timestamp is outside the replay window")
+	}
+
+	// The value of the header is of the format: v0=<actualhash>
+	gotHash := strings.SplitN(signature, "=", 2)
+	if len(gotHash) != 2 || gotHash[0] != "v0" {
+		return errors.New("Invalid signature header provided")
+	}
 
-	hash := hmac.New(sha1.New, []byte(g.secret))
+	b, err := readBody(r)
+	if err != nil {
+		return err
+	}
+
+	hash := hmac.New(sha256.New, []byte(s.secret))
+	fmt.Fprintf(hash, "v0:%s:", timestamp)
 	if _, err := hash.Write(b); err != nil {
 		return err
 	}
 
-	expectedHash := hex.EncodeToString(hash.Sum(nil))
-	if expectedHash != gotHash[1] {
+	got, err := hex.DecodeString(gotHash[1])
+	if err != nil || !hmac.Equal(hash.Sum(nil), got) {
 		return errors.New("Hashes do not match")
 	}
 	return nil
 }
+
+// readBody reads the request body and replaces it so that it can be re-read
+// after validation.
+func readBody(r *http.Request) ([]byte, error) {
+	defer r.Body.Close()
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSlackSigner signs requests the same way Slack does, so that tests can
+// exercise SlackRequestValidator without a real signing secret.
+type fakeSlackSigner struct {
+	secret string
+}
+
+func (f fakeSlackSigner) sign(r *http.Request, body string, ts time.Time) {
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+
+	h := hmac.New(sha256.New, []byte(f.secret))
+	fmt.Fprintf(h, "v0:%s:%s", timestamp, body)
+
+	r.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	r.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(h.Sum(nil)))
+}
+
+func newSlackRequest(body string) *http.Request {
+	r := httptest.NewRequest("POST", "/slack/interact", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestSlackRequestValidator(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	body := url.Values{"payload": {`{"type":"block_actions"}`}}.Encode()
+
+	validator := NewSlackRequestValidator("s3cr3t", DefaultSlackRequestMaxAge)
+	validator.now = func() time.Time { return now }
+
+	cases := []struct {
+		name    string
+		prepare func(*http.Request)
+		valid   bool
+	}{
+		{
+			name:    "valid signature",
+			prepare: func(r *http.Request) { fakeSlackSigner{"s3cr3t"}.sign(r, body, now) },
+			valid:   true,
+		},
+		{
+			name:    "unsigned request",
+			prepare: func(r *http.Request) {},
+		},
+		{
+			name:    "wrong secret",
+			prepare: func(r *http.Request) { fakeSlackSigner{"other"}.sign(r, body, now) },
+		},
+		{
+			name:    "stale timestamp",
+			prepare: func(r *http.Request) { fakeSlackSigner{"s3cr3t"}.sign(r, body, now.Add(-6*time.Minute)) },
+		},
+		{
+			name:    "timestamp from the future",
+			prepare: func(r *http.Request) { fakeSlackSigner{"s3cr3t"}.sign(r, body, now.Add(6*time.Minute)) },
+		},
+		{
+			name:    "tampered body",
+			prepare: func(r *http.Request) { fakeSlackSigner{"s3cr3t"}.sign(r, body+"&x=1", now) },
+		},
+		{
+			name: "malformed signature",
+			prepare: func(r *http.Request) {
+				fakeSlackSigner{"s3cr3t"}.sign(r, body, now)
+				r.Header.Set("X-Slack-Signature", "v1=abcdef")
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newSlackRequest(body)
+			tc.prepare(r)
+
+			err := validator.ValidateSignature(r)
+			if tc.valid && err != nil {
+				t.Fatalf("expected request to be valid, got: %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Fatal("expected request to be rejected")
+			}
+		})
+	}
+}
+
+func TestSlackRequestValidatorPreservesBody(t *testing.T) {
+	now := time.Now()
+	body := url.Values{"payload": {`{"type":"block_actions"}`}}.Encode()
+
+	r := newSlackRequest(body)
+	fakeSlackSigner{"s3cr3t"}.sign(r, body, now)
+
+	if err := NewSlackRequestValidator("s3cr3t", DefaultSlackRequestMaxAge).ValidateSignature(r); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != body {
+		t.Fatalf("expected body to be re-readable, got: %q", b)
+	}
+}
+
+func TestHandleSlackInteractionRejectsUnsignedRequests(t *testing.T) {
+	outcome := &fakeNotifier{}
+	slackValidator := NewSlackRequestValidator("s3cr3t", DefaultSlackRequestMaxAge)
+
+	s := httptest.NewServer(NewServer(outcome, &fakeWebhookValidator{}, slackValidator))
+	defer s.Close()
+
+	body := url.Values{"payload": {`{"type":"block_actions"}`}}.Encode()
+	resp, err := http.Post(s.URL+"/slack/interact", "application/x-www-form-urlencoded", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected status code to be 401, got %d", resp.StatusCode)
+	}
+}
+
+func signGitHubRequest(r *http.Request, header, prefix string, hashFunc func() hash.Hash, secret, body string) {
+	h := hmac.New(hashFunc, []byte(secret))
+	h.Write([]byte(body))
+	r.Header.Set(header, prefix+"="+hex.EncodeToString(h.Sum(nil)))
+}
+
+func TestGitHubWebhookValidator(t *testing.T) {
+	body := `{"action":"submitted"}`
+
+	cases := []struct {
+		name      string
+		allowSHA1 bool
+		prepare   func(*http.Request)
+		valid     bool
+	}{
+		{
+			name: "sha256 signature",
+			prepare: func(r *http.Request) {
+				signGitHubRequest(r, "X-Hub-Signature-256", "sha256", sha256.New, "current", body)
+			},
+			valid: true,
+		},
+		{
+			name: "sha256 signature with previous secret",
+			prepare: func(r *http.Request) {
+				signGitHubRequest(r, "X-Hub-Signature-256", "sha256", sha256.New, "previous", body)
+			},
+			valid: true,
+		},
+		{
+			name: "sha256 signature with unknown secret",
+			prepare: func(r *http.Request) {
+				signGitHubRequest(r, "X-Hub-Signature-256", "sha256", sha256.New, "unknown", body)
+			},
+		},
+		{
+			name: "sha256 preferred over sha1",
+			prepare: func(r *http.Request) {
+				signGitHubRequest(r, "X-Hub-Signature-256", "sha256", sha256.New, "unknown", body)
+				signGitHubRequest(r, "X-Hub-Signature", "sha1", sha1.New, "current", body)
+			},
+			allowSHA1: true,
+		},
+		{
+			name: "sha1 fallback",
+			prepare: func(r *http.Request) {
+				signGitHubRequest(r, "X-Hub-Signature", "sha1", sha1.New, "current", body)
+			},
+			allowSHA1: true,
+			valid:     true,
+		},
+		{
+			name: "sha1 refused",
+			prepare: func(r *http.Request) {
+				signGitHubRequest(r, "X-Hub-Signature", "sha1", sha1.New, "current", body)
+			},
+		},
+		{
+			name:    "unsigned request",
+			prepare: func(r *http.Request) {},
+		},
+		{
+			name: "malformed signature",
+			prepare: func(r *http.Request) {
+				r.Header.Set("X-Hub-Signature-256", "sha256")
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			validator := NewGitHubWebhookValidator([]string{"current", "previous"}, tc.allowSHA1)
+
+			r := httptest.NewRequest("POST", "/github", strings.NewReader(body))
+			tc.prepare(r)
+
+			err := validator.ValidateSignature(r)
+			if tc.valid && err != nil {
+				t.Fatalf("expected request to be valid, got: %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Fatal("expected request to be rejected")
+			}
+		})
+	}
+}
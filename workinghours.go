@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	slackapi "github.com/slack-go/slack"
+)
+
+// WorkingHoursConfig decides when people can be sent direct messages and
+// reminders.
+type WorkingHoursConfig struct {
+	Default WorkingHours `json:"default"`
+
+	// Users maps GitHub logins to the working hours that replace the
+	// default ones, field by field.
+	Users map[string]WorkingHours `json:"users"`
+}
+
+// WorkingHours are the hours of the day, on some days of the week, that
+// someone is working.
+type WorkingHours struct {
+	// Start and End are times of day such as "09:00" and "17:30".
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+
+	// Weekdays are abbreviated day names, e.g. ["mon", "tue"]. Defaults to
+	// Monday to Friday.
+	Weekdays []string `json:"weekdays,omitempty"`
+
+	// Timezone is an IANA timezone name such as "Europe/London". Defaults to
+	// the timezone in the user's Slack profile.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+var defaultWeekdays = []string{"mon", "tue", "wed", "thu", "fri"}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// LoadWorkingHours reads and validates working hours from a JSON file.
+func LoadWorkingHours(filename string) (*WorkingHoursConfig, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var config WorkingHoursConfig
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return nil, fmt.Errorf("couldn't parse %s: %w", filename, err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid working hours in %s: %w", filename, err)
+	}
+	return &config, nil
+}
+
+func (w *WorkingHoursConfig) Validate() error {
+	if w.Default.Start == "" || w.Default.End == "" {
+		return errors.New("no default start and end")
+	}
+
+	if err := w.Default.validate(); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+
+	for login := range w.Users {
+		if err := w.For(login).validate(); err != nil {
+			return fmt.Errorf("user %q: %w", login, err)
+		}
+	}
+	return nil
+}
+
+// For returns the working hours of the GitHub user.
+func (w *WorkingHoursConfig) For(login string) WorkingHours {
+	hours := w.Default
+
+	for l, override := range w.Users {
+		if !strings.EqualFold(l, login) {
+			continue
+		}
+
+		if override.Start != "" {
+			hours.Start = override.Start
+		}
+		if override.End != "" {
+			hours.End = override.End
+		}
+		if len(override.Weekdays) > 0 {
+			hours.Weekdays = override.Weekdays
+		}
+		if override.Timezone != "" {
+			hours.Timezone = override.Timezone
+		}
+	}
+	return hours
+}
+
+func (h WorkingHours) validate() error {
+	start, err := parseTimeOfDay(h.Start)
+	if err != nil {
+		return err
+	}
+	end, err := parseTimeOfDay(h.End)
+	if err != nil {
+		return err
+	}
+	if end <= start {
+		return fmt.Errorf("end %s is not after start %s", h.End, h.Start)
+	}
+
+	for _, day := range h.Weekdays {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("unknown weekday %q", day)
+		}
+	}
+
+	if h.Timezone != "" {
+		if _, err := time.LoadLocation(h.Timezone); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Location returns the timezone the working hours are in, falling back to the
+// Slack user's timezone, and then to UTC.
+func (h WorkingHours) Location(user *slackapi.User) *time.Location {
+	for _, name := range []string{h.Timezone, slackTimezone(user)} {
+		if name == "" {
+			continue
+		}
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+
+	if user != nil && user.TZOffset != 0 {
+		return time.FixedZone(user.TZLabel, user.TZOffset)
+	}
+	return time.UTC
+}
+
+func slackTimezone(user *slackapi.User) string {
+	if user == nil {
+		return ""
+	}
+	return user.TZ
+}
+
+// Next returns t if it is within the working hours, or else the time they
+// next start.
+func (h WorkingHours) Next(t time.Time, loc *time.Location) time.Time {
+	// The hours have been validated when they were loaded.
+	start, _ := parseTimeOfDay(h.Start)
+	end, _ := parseTimeOfDay(h.End)
+
+	days := h.Weekdays
+	if len(days) == 0 {
+		days = defaultWeekdays
+	}
+
+	t = t.In(loc)
+	for offset := 0; offset <= 7; offset++ {
+		day := time.Date(t.Year(), t.Month(), t.Day()+offset, 0, 0, 0, 0, loc)
+		if !slices.ContainsFunc(days, func(d string) bool { return weekdays[strings.ToLower(d)] == day.Weekday() }) {
+			continue
+		}
+
+		dayStart, dayEnd := atTimeOfDay(day, start), atTimeOfDay(day, end)
+		if t.Before(dayStart) {
+			return dayStart
+		}
+		if t.Before(dayEnd) {
+			return t
+		}
+	}
+	return t
+}
+
+// atTimeOfDay returns the time of day on the day, as shown on clocks in its
+// location. Unlike adding the time since midnight, this holds on the days
+// clocks change.
+func atTimeOfDay(day time.Time, d time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), int(d/time.Hour), int(d%time.Hour/time.Minute), 0, 0, day.Location())
+}
+
+// parseTimeOfDay parses a time such as "09:30" into the time since midnight.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected e.g. 09:30", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	slackapi "github.com/slack-go/slack"
+)
+
+func TestWorkingHoursNext(t *testing.T) {
+	hours := WorkingHours{Start: "09:00", End: "17:30"}
+	loc, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{"during working hours", time.Date(2024, 1, 3, 11, 0, 0, 0, loc), time.Date(2024, 1, 3, 11, 0, 0, 0, loc)},
+		{"before work", time.Date(2024, 1, 3, 3, 0, 0, 0, loc), time.Date(2024, 1, 3, 9, 0, 0, 0, loc)},
+		{"after work", time.Date(2024, 1, 3, 18, 0, 0, 0, loc), time.Date(2024, 1, 4, 9, 0, 0, 0, loc)},
+		{"friday evening", time.Date(2024, 1, 5, 18, 0, 0, 0, loc), time.Date(2024, 1, 8, 9, 0, 0, 0, loc)},
+		{"another timezone", time.Date(2024, 1, 3, 3, 0, 0, 0, time.UTC), time.Date(2024, 1, 3, 9, 0, 0, 0, loc)},
+	}
+
+	for _, tt := range tests {
+		if got := hours.Next(tt.t, loc); !got.Equal(tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	// Clocks go forward an hour on the last Sunday of March.
+	weekend := WorkingHours{Start: "09:00", End: "17:30", Weekdays: []string{"sun"}}
+	for _, tt := range []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{"before work when clocks change", time.Date(2024, 3, 31, 3, 0, 0, 0, loc), time.Date(2024, 3, 31, 9, 0, 0, 0, loc)},
+		{"after work when clocks change", time.Date(2024, 3, 31, 17, 45, 0, 0, loc), time.Date(2024, 4, 7, 9, 0, 0, 0, loc)},
+		{"after work when clocks go back", time.Date(2024, 10, 27, 17, 45, 0, 0, loc), time.Date(2024, 11, 3, 9, 0, 0, 0, loc)},
+	} {
+		if got := weekend.Next(tt.t, loc); !got.Equal(tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestWorkingHoursConfigFor(t *testing.T) {
+	config := &WorkingHoursConfig{
+		Default: WorkingHours{Start: "09:00", End: "17:00"},
+		Users: map[string]WorkingHours{
+			"BRMatt": {Start: "11:00", Timezone: "America/New_York"},
+		},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	hours := config.For("brmatt")
+	if hours.Start != "11:00" || hours.End != "17:00" || hours.Timezone != "America/New_York" {
+		t.Errorf("expected the override to replace the default field by field, got: %#v", hours)
+	}
+
+	if loc := config.For("someone").Location(&slackapi.User{TZ: "Asia/Tokyo"}); loc.String() != "Asia/Tokyo" {
+		t.Errorf("expected the Slack timezone to be used, got %v", loc)
+	}
+	if loc := hours.Location(&slackapi.User{TZ: "Asia/Tokyo"}); loc.String() != "America/New_York" {
+		t.Errorf("expected the configured timezone to take precedence, got %v", loc)
+	}
+}
+
+func TestWorkingHoursConfigValidate(t *testing.T) {
+	tests := []WorkingHoursConfig{
+		{},
+		{Default: WorkingHours{Start: "17:00", End: "09:00"}},
+		{Default: WorkingHours{Start: "9am", End: "17:00"}},
+		{Default: WorkingHours{Start: "09:00", End: "17:00", Weekdays: []string{"funday"}}},
+		{Default: WorkingHours{Start: "09:00", End: "17:00"}, Users: map[string]WorkingHours{"a": {Timezone: "Mars/Olympus"}}},
+	}
+
+	for _, config := range tests {
+		if err := config.Validate(); err == nil {
+			t.Errorf("expected %#v to be invalid", config)
+		}
+	}
+}